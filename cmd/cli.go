@@ -1,16 +1,24 @@
 package cmd
 
 import (
+	"context"
 	"embed"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/jamesbehr/torpedo/core"
-	"github.com/jamesbehr/torpedo/picker"
+	"github.com/jamesbehr/torpedo/format"
 )
 
 var defaultTemplate embed.FS
@@ -52,12 +60,145 @@ func (ctx *Context) UnexpandPath(p string) string {
 	return p
 }
 
+// OpenProject attaches to the session for a layout profile of a project,
+// creating the session if it does not exist.
+// Each profile other than the default gets a separate session, unless
+// switchLayout is set, in which case the windows of the project's session are
+// replaced with the profile instead.
+func (ctx *Context) OpenProject(projectPath, layout string, switchLayout bool) error {
+	cfg, err := ctx.Service.ParseProjectConfig(projectPath)
+	if err != nil {
+		return err
+	}
+
+	windows, err := cfg.Layout(layout)
+	if err != nil {
+		return err
+	}
+
+	sessionName := ctx.UnexpandPath(projectPath)
+	if layout != "" && layout != cfg.DefaultLayout && !switchLayout {
+		sessionName += "#" + layout
+	}
+
+	exists, err := ctx.Service.HasSession(sessionName)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		if err := ctx.Service.CreateSession(sessionName, projectPath, cfg.Session, windows); err != nil {
+			return err
+		}
+	} else if switchLayout {
+		if err := ctx.Service.ReplaceWindows(sessionName, projectPath, windows); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Service.AttachSession(sessionName)
+}
+
+// CurrentProject returns the project of the tmux session that torpedo is
+// running in, or the project of the working directory if it isn't running in a
+// project's session.
+func (ctx *Context) CurrentProject() (string, error) {
+	if sessionName, err := ctx.Service.CurrentSession(); err == nil {
+		if path, ok := ctx.SessionProject(sessionName); ok {
+			return path, nil
+		}
+	}
+
+	return ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+}
+
+// SessionProject returns the project that a session was opened for by
+// [Context.OpenProject].
+func (ctx *Context) SessionProject(sessionName string) (string, bool) {
+	// Sessions for layout profiles have the profile after a #, but the
+	// project path could contain one too
+	candidates := []string{sessionName}
+	if i := strings.LastIndex(sessionName, "#"); i >= 0 {
+		candidates = append(candidates, sessionName[:i])
+	}
+
+	for _, candidate := range candidates {
+		path := ctx.ExpandPath(candidate)
+		if !filepath.IsAbs(path) {
+			continue
+		}
+
+		if _, err := os.Stat(ctx.Service.ProjectDataFilePath(path, "")); err == nil {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+// TemplateSearchPaths returns the directories that contain project templates.
+func (ctx *Context) TemplateSearchPaths() []string {
+	if v, ok := os.LookupEnv("TORPEDO_TEMPLATE_PATH"); ok {
+		return filepath.SplitList(v)
+	}
+
+	return []string{
+		"/etc/torpedo/templates",
+		ctx.ConfigFilePath("templates"),
+	}
+}
+
 func (ctx *Context) ConfigFilePath(name string) string {
 	return filepath.Join(ctx.ConfigRoot, "torpedo", name)
 }
 
+// OutputFlags are the flags that choose how commands that list things write
+// their output.
+// The command has to set the fields variable to the fields of its rows, which
+// the rows can be sorted by.
+type OutputFlags struct {
+	Format   string   `default:"text" predictor:"formats" help:"The output format, which is one of ${formats}, or a Go template that is run for each row"`
+	Sort     []string `enum:"${fields}" help:"Sort by these fields, with the later ones breaking ties"`
+	Reverse  bool     `help:"Reverse the order"`
+	NoHeader bool     `help:"Leave out the header of the text, csv and tsv formats"`
+	Color    string   `enum:"auto,always,never" default:"auto" help:"When to colour the text format, where auto colours it in a terminal unless NO_COLOR is set (${enum})"`
+}
+
+// Formatter returns a formatter for the fields, which writes to w.
+// Text written to a terminal is shortened to fit in it.
+func (flags *OutputFlags) Formatter(fields []string, w io.Writer) (format.Formatter, error) {
+	return flags.formatter(fields, w, false)
+}
+
+// LocationFormatter is like [OutputFlags.Formatter], for rows that are
+// locations in files, so the formats for them can also be used.
+func (flags *OutputFlags) LocationFormatter(fields []string, w io.Writer) (format.Formatter, error) {
+	return flags.formatter(fields, w, true)
+}
+
+func (flags *OutputFlags) formatter(fields []string, w io.Writer, locations bool) (format.Formatter, error) {
+	terminal, width := format.Terminal(w)
+
+	color := false
+	switch flags.Color {
+	case "always":
+		color = true
+	case "auto":
+		color = terminal && os.Getenv("NO_COLOR") == ""
+	}
+
+	return format.New(flags.Format, fields, w, format.Options{
+		Sort:      flags.Sort,
+		Reverse:   flags.Reverse,
+		NoHeader:  flags.NoHeader,
+		Color:     color,
+		Width:     width,
+		Locations: locations,
+	})
+}
+
 type InitCmd struct {
-	Template string `default:"default"`
+	Template string `default:"default" predictor:"templates"`
 }
 
 func (cmd *InitCmd) Run(ctx *Context) error {
@@ -69,16 +210,7 @@ func (cmd *InitCmd) Run(ctx *Context) error {
 		return errors.New("projects should not be nested")
 	}
 
-	searchPaths := []string{
-		"/etc/torpedo/templates",
-		ctx.ConfigFilePath("templates"),
-	}
-
-	if v, ok := os.LookupEnv("TORPEDO_TEMPLATE_PATH"); ok {
-		searchPaths = filepath.SplitList(v)
-	}
-
-	dir, err := ctx.Service.FindTemplateDir(cmd.Template, searchPaths)
+	dir, err := ctx.Service.FindTemplateDir(cmd.Template, ctx.TemplateSearchPaths())
 	if err != nil {
 		return err
 	}
@@ -86,33 +218,129 @@ func (cmd *InitCmd) Run(ctx *Context) error {
 	return ctx.Service.InitializeProject(ctx.WorkingDirectory, dir)
 }
 
-type PickCmd struct {
-	Paths []string
+type RunCmd struct {
+	Directory   string   `default:"." predictor:"dirs" help:"Find the project from this directory instead of the current one"`
+	Fields      []string `default:"name,description" enum:"${fields}" help:"The fields to show when listing commands"`
+	OutputFlags `embed:""`
+	In          string   `enum:",window,pane,popup" default:"" help:"Run the command in a window, pane or popup in the project's session"`
+	Name        string   `help:"The name of the window to run the command in, which is reused if it exists, or the title of the popup (defaults to the command)"`
+	Wait        bool     `help:"Wait for a command run with --in to finish"`
+	Watch       bool     `help:"Run the command again whenever the project's files change"`
+	Report      string   `hidden:"" help:"The channel to report the exit status on"`
+	Hold        bool     `hidden:"" help:"Keep the pane open after the command exits"`
+	Command     string   `arg:"" optional:"" predictor:"commands"`
+	Args        []string `arg:"" optional:""`
 }
 
-func (cmd *PickCmd) Run(ctx *Context) error {
-	projects, err := ctx.Service.FindProjects(cmd.Paths)
-	if err != nil {
-		return err
+func (cmd *RunCmd) Run(ctx *Context) (err error) {
+	// Something is waiting for the status, so it has to be reported however
+	// this exits, or it would wait forever
+	if cmd.Report != "" {
+		report := cmd.reportStatus(ctx)
+		defer func() {
+			err = errors.Join(err, report(exitStatus(err)))
+		}()
 	}
 
-	for i := range projects {
-		projects[i] = ctx.UnexpandPath(projects[i])
+	projectDir, err := ctx.Service.FindCurrentProject(ctx.ExpandPath(cmd.Directory))
+	if err != nil {
+		return err
 	}
 
-	choice, err := picker.Pick(projects)
+	config, err := ctx.Service.ParseProjectConfig(projectDir)
 	if err != nil {
 		return err
 	}
 
-	projectPath := ctx.ExpandPath(choice)
+	if cmd.Command == "" {
+		return cmd.list(ctx, config.Commands)
+	}
+
+	if _, ok := config.Commands[cmd.Command]; !ok {
+		return fmt.Errorf("unknown command %q", cmd.Command)
+	}
+
+	if cmd.Watch && cmd.Wait {
+		return errors.New("--wait can't be used with --watch, since watching never finishes")
+	}
+
+	if cmd.In != "" {
+		return cmd.runInSession(ctx, projectDir, config)
+	}
+
+	if cmd.Watch {
+		// Stop the command when torpedo is stopped, instead of leaving it
+		// running in the background
+		watchCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		defer stop()
+
+		return ctx.Service.WatchProjectCommand(watchCtx, projectDir, ctx.Shell, config.Commands, cmd.Command, cmd.Args, os.Stderr)
+	}
+
+	if cmd.Hold {
+		if err := ctx.Service.HoldPane(os.Getenv("TMUX_PANE")); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Service.RunProjectCommand(projectDir, ctx.Shell, config.Commands, cmd.Command, cmd.Args)
+}
+
+// reportStatus returns a function that reports the exit status on the
+// channel given by --report.
+// Killing the pane or popup hangs up torpedo, so a status is reported then
+// too, and only the first status is reported.
+func (cmd *RunCmd) reportStatus(ctx *Context) func(status int) error {
+	var once sync.Once
+
+	report := func(status int) error {
+		var err error
+		once.Do(func() {
+			err = ctx.Service.ReportCommandStatus(cmd.Report, status)
+		})
 
-	cfg, err := ctx.Service.ParseProjectConfig(projectPath)
-	if err != nil {
 		return err
 	}
 
-	sessionName := ctx.UnexpandPath(projectPath)
+	// Interrupts also reach the command, which exits and has its status
+	// reported as usual, so torpedo only has to outlive them
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGHUP, syscall.SIGTERM)
+
+	go func() {
+		for sig := range signals {
+			if sig == os.Interrupt {
+				continue
+			}
+
+			status := 128 + int(sig.(syscall.Signal))
+			report(status)
+			os.Exit(status)
+		}
+	}()
+
+	return report
+}
+
+// exitStatus returns the exit status that torpedo has when Run returns err.
+// Commands that fail keep their own status.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return 1
+}
+
+// runInSession runs the command again inside the project's session, creating
+// the session if needed.
+func (cmd *RunCmd) runInSession(ctx *Context, projectDir string, config *core.Config) error {
+	sessionName := ctx.UnexpandPath(projectDir)
 
 	exists, err := ctx.Service.HasSession(sessionName)
 	if err != nil {
@@ -120,51 +348,138 @@ func (cmd *PickCmd) Run(ctx *Context) error {
 	}
 
 	if !exists {
-		if err := ctx.Service.CreateSession(sessionName, projectPath, cfg.Windows); err != nil {
+		windows, err := config.Layout("")
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Service.CreateSession(sessionName, projectDir, config.Session, windows); err != nil {
 			return err
 		}
 	}
 
-	return ctx.Service.AttachSession(sessionName)
-}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
 
-type RunCmd struct {
-	Directory string   `default:"."`
-	Command   string   `arg:""`
-	Args      []string `arg:"" optional:""`
-}
+	args := []string{executable, "run", "--directory", projectDir}
+
+	// Only report the status if something is waiting for it, otherwise it
+	// would never be cleaned up
+	channel := fmt.Sprintf("torpedo-run-%d-%d", os.Getpid(), time.Now().UnixNano())
+	if cmd.Wait {
+		args = append(args, "--report", channel)
+	}
+
+	if cmd.Watch {
+		args = append(args, "--watch")
+	}
+
+	// Popups stay open until they are closed anyway
+	if cmd.In != core.RunInPopup {
+		args = append(args, "--hold")
+	}
 
-func (cmd *RunCmd) Run(ctx *Context) error {
-	projectDir, err := ctx.Service.FindCurrentProject(cmd.Directory)
+	args = append(args, "--", cmd.Command)
+	args = append(args, cmd.Args...)
+
+	name := cmd.Name
+	if name == "" {
+		name = cmd.Command
+	}
+
+	pane, err := ctx.Service.RunInSession(sessionName, projectDir, cmd.In, name, args)
 	if err != nil {
 		return err
 	}
 
-	config, err := ctx.Service.ParseProjectConfig(projectDir)
+	if !cmd.Wait {
+		return nil
+	}
+
+	status, err := ctx.Service.WaitForCommandStatus(channel, pane)
 	if err != nil {
 		return err
 	}
 
-	script, ok := config.Commands[cmd.Command]
-	if !ok {
-		return fmt.Errorf("unknown command %q", cmd.Command)
+	if status != 0 {
+		return fmt.Errorf("command %q exited with status %d", cmd.Command, status)
+	}
+
+	return nil
+}
+
+func (cmd *RunCmd) list(ctx *Context, commands map[string]core.Command) error {
+	formatter, err := cmd.Formatter(cmd.Fields, ctx.Stdout)
+	if err != nil {
+		return err
 	}
 
-	return ctx.Service.RunProjectScript(projectDir, "sh", script, cmd.Args)
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		data := map[string]any{
+			"name":        name,
+			"description": commands[name].Description,
+			"run":         commands[name].Run,
+		}
+
+		if err := formatter.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return formatter.Close()
+}
+
+type WaitForCmd struct {
+	File    []string      `help:"Wait until the file exists"`
+	TCP     []string      `name:"tcp" help:"Wait until the address accepts TCP connections"`
+	Timeout time.Duration `default:"5m"`
+	Target  string        `required:"" help:"The pane to send keys to"`
+	Keys    []string      `arg:"" optional:"" help:"Lines to type into the pane"`
+}
+
+func (cmd *WaitForCmd) Run(ctx *Context) error {
+	if err := ctx.Service.WaitFor(cmd.File, cmd.TCP, cmd.Timeout); err != nil {
+		// This runs in the background from run-shell, so nobody would see
+		// the error otherwise
+		message := fmt.Sprintf("torpedo: %s, so the keys were not sent", err)
+		return errors.Join(err, ctx.Service.ShowMessage(cmd.Target, message))
+	}
+
+	return ctx.Service.SendLines(cmd.Target, cmd.Keys)
 }
 
 type CLI struct {
-	Init      InitCmd      `cmd:"" help:"Initialize a project"`
-	Pick      PickCmd      `cmd:"" help:"Find project and jump to it"`
-	Marks     MarksCmd     `cmd:"" help:"Manage project marks"`
-	FileMarks FileMarksCmd `cmd:"" help:"Manage file marks within a project"`
-	Run       RunCmd       `cmd:"" help:"Run a project command"`
+	Init       InitCmd       `cmd:"" help:"Initialize a project"`
+	Pick       PickCmd       `cmd:"" help:"Find project and jump to it"`
+	Preview    PreviewCmd    `cmd:"" help:"Show what a project is, for the preview of the picker"`
+	Marks      MarksCmd      `cmd:"" help:"Manage project marks"`
+	FileMarks  FileMarksCmd  `cmd:"" help:"Manage file marks within a project"`
+	Run        RunCmd        `cmd:"" set:"fields=name,description,run" help:"Run a project command, or list them"`
+	Config     ConfigCmd     `cmd:"" help:"Manage the project config"`
+	WaitFor    WaitForCmd    `cmd:"" hidden:"" help:"Wait for a condition then send keys to a pane"`
+	Completion CompletionCmd `cmd:"" help:"Print a shell completion script"`
+	Complete   CompleteCmd   `cmd:"" name:"__complete" hidden:"" help:"Print completions for a partial command line"`
 }
 
 var cli CLI
 
+// vars are the variables that the help and tags of the CLI use.
+var vars = kong.Vars{
+	"formats":          strings.Join(format.Formats, ", "),
+	"location_formats": strings.Join(format.LocationFormats, ", "),
+}
+
 func Execute() {
-	ctx := kong.Parse(&cli)
+	ctx := kong.Parse(&cli, vars)
 
 	home := os.Getenv("HOME")
 	if !filepath.IsAbs(home) {
@@ -187,7 +502,7 @@ func Execute() {
 	}
 
 	context := Context{
-		Service:          core.New(),
+		Service:          core.New(filepath.Join(configHome, "torpedo")),
 		Stdout:           os.Stdout,
 		WorkingDirectory: wd,
 		Home:             home,
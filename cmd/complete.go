@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/jamesbehr/torpedo/format"
+	"github.com/jamesbehr/torpedo/marks"
+)
+
+var completionScripts = map[string]string{
+	"bash": `_torpedo() {
+    local IFS=$'\n'
+    COMPREPLY=($(torpedo __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+
+    # Don't add a space after a directory, so its subdirectories can be completed
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+        compopt -o nospace
+    fi
+}
+
+complete -F _torpedo torpedo
+`,
+	"zsh": `#compdef torpedo
+compdef _torpedo torpedo
+
+_torpedo() {
+    local -a candidates dirs
+    candidates=("${(@f)$(torpedo __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+
+    # Don't add a space after a directory, so its subdirectories can be completed
+    dirs=(${(M)candidates:#*/})
+    candidates=(${${candidates:#*/}:#})
+
+    compadd -S '' -a dirs
+    compadd -a candidates
+}
+
+# Only run the function when it is autoloaded, not when the script is sourced
+if [ "$funcstack[1]" = "_torpedo" ]; then
+    _torpedo "$@"
+fi
+`,
+	"fish": `complete -c torpedo -f -a '(torpedo __complete -- (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`,
+}
+
+type CompletionCmd struct {
+	Shell string `arg:"" enum:"bash,zsh,fish" help:"The shell to print the completion script for (${enum})"`
+}
+
+func (cmd *CompletionCmd) Run(ctx *Context) error {
+	_, err := io.WriteString(ctx.Stdout, completionScripts[cmd.Shell])
+	return err
+}
+
+// CompleteCmd is called by the completion scripts with the words on the
+// command line after torpedo, up to and including the word being completed.
+type CompleteCmd struct {
+	Words []string `arg:"" optional:"" passthrough:""`
+}
+
+func (cmd *CompleteCmd) Run(ctx *Context, kctx *kong.Context) error {
+	// The scripts pass -- so that the words aren't parsed as flags, but
+	// passthrough arguments keep it
+	words := cmd.Words
+	if len(words) > 0 && words[0] == "--" {
+		words = words[1:]
+	}
+
+	for _, candidate := range complete(ctx, kctx.Model.Node, words) {
+		if _, err := fmt.Fprintln(ctx.Stdout, candidate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// predictors complete the values of flags and arguments, which choose a
+// predictor with the predictor tag.
+// They are given the partial value, but don't have to filter by it.
+var predictors = map[string]func(ctx *Context, prefix string) []string{
+	"commands":         predictCommands,
+	"marks":            predictMarks,
+	"file-marks":       predictFileMarks,
+	"branches":         predictFileMarkBranches,
+	"formats":          predictFormats,
+	"location-formats": predictLocationFormats,
+	"templates":        predictTemplates,
+	"dirs":             predictDirs,
+}
+
+// complete returns the candidates for the last word, by following the
+// commands and flags in the words before it.
+func complete(ctx *Context, node *kong.Node, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+
+	current := words[len(words)-1]
+
+	var flagValue *kong.Flag
+	positional := 0
+	flagsDone := false
+
+	// values are the values of the flags before the current word
+	values := map[string]string{}
+
+	for _, word := range words[:len(words)-1] {
+		switch {
+		case flagValue != nil && word == "=":
+			// Bash splits --flag=value into separate words
+		case flagValue != nil:
+			values[flagValue.Name] = word
+			flagValue = nil
+		case word == "--":
+			flagsDone = true
+		case !flagsDone && strings.HasPrefix(word, "-"):
+			flag := findFlag(node, word)
+			if flag == nil || flag.IsBool() {
+				break
+			}
+
+			if _, value, ok := strings.Cut(word, "="); ok {
+				values[flag.Name] = value
+			} else {
+				flagValue = flag
+			}
+		default:
+			if child := findChild(node, word); child != nil && positional == 0 {
+				node = child
+				continue
+			}
+
+			positional++
+		}
+	}
+
+	// Commands that take --directory find the project from it, so the
+	// predictors have to as well
+	if dir, ok := values["directory"]; ok {
+		dir = ctx.ExpandPath(dir)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(ctx.WorkingDirectory, dir)
+		}
+
+		dirCtx := *ctx
+		dirCtx.WorkingDirectory = dir
+		ctx = &dirCtx
+	}
+
+	candidates := []string{}
+
+	switch {
+	case flagValue != nil && current == "=":
+		for _, candidate := range predict(ctx, node, flagValue.Value, "") {
+			candidates = append(candidates, "="+candidate)
+		}
+	case flagValue != nil:
+		candidates = predict(ctx, node, flagValue.Value, current)
+	case !flagsDone && strings.HasPrefix(current, "-"):
+		if name, value, ok := strings.Cut(current, "="); ok {
+			if flag := findFlag(node, name); flag != nil {
+				for _, candidate := range predict(ctx, node, flag.Value, value) {
+					candidates = append(candidates, name+"="+candidate)
+				}
+			}
+
+			break
+		}
+
+		for _, group := range node.AllFlags(true) {
+			for _, flag := range group {
+				candidates = append(candidates, "--"+flag.Name)
+			}
+		}
+	case positional == 0 && len(node.Children) > 0:
+		for _, child := range node.Children {
+			if !child.Hidden {
+				candidates = append(candidates, child.Name)
+				candidates = append(candidates, child.Aliases...)
+			}
+		}
+	case len(node.Positional) > 0:
+		arg := node.Positional[min(positional, len(node.Positional)-1)]
+		if positional < len(node.Positional) || arg.IsSlice() {
+			candidates = predict(ctx, node, arg, current)
+		}
+	}
+
+	matches := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	slices.Sort(matches)
+
+	return slices.Compact(matches)
+}
+
+func findFlag(node *kong.Node, word string) *kong.Flag {
+	name, _, _ := strings.Cut(word, "=")
+
+	for _, group := range node.AllFlags(false) {
+		for _, flag := range group {
+			if name == "--"+flag.Name || (flag.Short != 0 && name == "-"+string(flag.Short)) {
+				return flag
+			}
+
+			for _, alias := range flag.Aliases {
+				if name == "--"+alias {
+					return flag
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func findChild(node *kong.Node, word string) *kong.Node {
+	for _, child := range node.Children {
+		if child.Name == word || slices.Contains(child.Aliases, word) {
+			return child
+		}
+	}
+
+	return nil
+}
+
+// predict completes a value of the command node using its enum, or its
+// predictor if it has one.
+func predict(ctx *Context, node *kong.Node, value *kong.Value, prefix string) []string {
+	if value.Enum != "" {
+		return slices.DeleteFunc(value.EnumSlice(), func(s string) bool { return s == "" })
+	}
+
+	name := value.Tag.Get("predictor")
+
+	// Commands whose rows are locations in files set locations, so that
+	// the formats for them are offered too
+	if name == "formats" && node.Vars()["locations"] == "true" {
+		name = "location-formats"
+	}
+
+	if predictor, ok := predictors[name]; ok {
+		return predictor(ctx, prefix)
+	}
+
+	return nil
+}
+
+func predictCommands(ctx *Context, prefix string) []string {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return nil
+	}
+
+	config, err := ctx.Service.ParseProjectConfig(dir)
+	if err != nil {
+		return nil
+	}
+
+	names := []string{}
+	for name := range config.Commands {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func predictMarks(ctx *Context, prefix string) []string {
+	m, err := marks.ReadMarks(ctx.ConfigFilePath("marks.json"))
+	if err != nil {
+		return nil
+	}
+
+	keys := []string{}
+	for _, mark := range m {
+		keys = append(keys, mark.Key)
+	}
+
+	return keys
+}
+
+func predictFileMarks(ctx *Context, prefix string) []string {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return nil
+	}
+
+	path, _, err := ctx.Service.FileMarksPath(dir)
+	if err != nil {
+		return nil
+	}
+
+	m, err := marks.ReadFileMarks(path)
+	if err != nil {
+		return nil
+	}
+
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func predictFileMarkBranches(ctx *Context, prefix string) []string {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return nil
+	}
+
+	branches, err := ctx.Service.FileMarksBranches(dir)
+	if err != nil {
+		return nil
+	}
+
+	return branches
+}
+
+func predictFormats(ctx *Context, prefix string) []string {
+	return format.Formats
+}
+
+func predictLocationFormats(ctx *Context, prefix string) []string {
+	return slices.Concat(format.Formats, format.LocationFormats)
+}
+
+func predictTemplates(ctx *Context, prefix string) []string {
+	names := []string{}
+
+	for _, searchPath := range ctx.TemplateSearchPaths() {
+		entries, err := os.ReadDir(searchPath)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+
+	return names
+}
+
+// predictDirs completes the directories in the directory that prefix is in.
+// Hidden directories are only included if prefix is the start of a hidden
+// name.
+func predictDirs(ctx *Context, prefix string) []string {
+	parent, base := filepath.Split(prefix)
+
+	dir := ctx.ExpandPath(parent)
+	if dir == "" {
+		dir = "."
+	}
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(ctx.WorkingDirectory, dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	dirs := []string{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+
+		// Follow symlinks to see if they point to a directory
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.IsDir() {
+			dirs = append(dirs, parent+name+"/")
+		}
+	}
+
+	return dirs
+}
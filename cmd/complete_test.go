@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/jamesbehr/torpedo/core"
+	"github.com/jamesbehr/torpedo/marks"
+	"github.com/stretchr/testify/require"
+)
+
+// writeProject creates a project in dir with a command for each name.
+func writeProject(t *testing.T, dir string, commands ...string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".torpedo"), 0o755))
+
+	config := `{"commands": {`
+	for i, name := range commands {
+		if i > 0 {
+			config += ", "
+		}
+
+		config += `"` + name + `": "true"`
+	}
+	config += `}}`
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".torpedo", "config.json"), []byte(config), 0o644))
+}
+
+func TestComplete(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	configRoot := filepath.Join(root, "config")
+
+	// Keep the lock for the marks out of the real runtime directory
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	writeProject(t, filepath.Join(root, "a"), "build", "test")
+	writeProject(t, filepath.Join(root, "b"), "deploy", "lint")
+	writeProject(t, filepath.Join(home, "c"), "serve")
+
+	err := marks.UpdateMarks(filepath.Join(configRoot, "torpedo", "marks.json"), func(m *marks.Marks) error {
+		m.Set("1", "~/c")
+		m.Set("2", filepath.Join(root, "a"))
+		return nil
+	})
+	require.NoError(t, err)
+
+	var c CLI
+	parser, err := kong.New(&c, vars)
+	require.NoError(t, err)
+
+	ctx := &Context{
+		Service:          core.New(filepath.Join(configRoot, "torpedo")),
+		WorkingDirectory: filepath.Join(root, "a"),
+		Home:             home,
+		ConfigRoot:       configRoot,
+	}
+
+	tests := []struct {
+		Name     string
+		Words    []string
+		Expected []string
+	}{
+		{
+			Name:     "commands",
+			Words:    []string{"ma"},
+			Expected: []string{"marks"},
+		},
+		{
+			Name:     "hidden commands are left out",
+			Words:    []string{"__"},
+			Expected: []string{},
+		},
+		{
+			Name:     "subcommands",
+			Words:    []string{"marks", "s"},
+			Expected: []string{"set", "swap"},
+		},
+		{
+			Name:     "flags",
+			Words:    []string{"marks", "list", "--so"},
+			Expected: []string{"--sort"},
+		},
+		{
+			Name:     "enum flag values",
+			Words:    []string{"marks", "list", "--color", ""},
+			Expected: []string{"always", "auto", "never"},
+		},
+		{
+			Name:     "enum flag values after =",
+			Words:    []string{"marks", "list", "--color=a"},
+			Expected: []string{"--color=always", "--color=auto"},
+		},
+		{
+			Name:     "enum flag values split by bash",
+			Words:    []string{"marks", "list", "--color", "="},
+			Expected: []string{"=always", "=auto", "=never"},
+		},
+		{
+			Name:     "enum flags from the command's tag",
+			Words:    []string{"marks", "list", "--fields", ""},
+			Expected: []string{"mark", "path", "project"},
+		},
+		{
+			Name:     "flag predictors",
+			Words:    []string{"run", "--format", "j"},
+			Expected: []string{"json", "json-array"},
+		},
+		{
+			Name:     "location formats",
+			Words:    []string{"file-marks", "next", "--format", "q"},
+			Expected: []string{"quickfix"},
+		},
+		{
+			Name:     "location formats only for locations",
+			Words:    []string{"marks", "list", "--format", "q"},
+			Expected: []string{},
+		},
+		{
+			Name:     "bool flags don't take a value",
+			Words:    []string{"run", "--wait", ""},
+			Expected: []string{"build", "test"},
+		},
+		{
+			Name:     "positional predictors",
+			Words:    []string{"marks", "jump", ""},
+			Expected: []string{"1", "2"},
+		},
+		{
+			Name:     "positionals after the last one",
+			Words:    []string{"marks", "del", "1", ""},
+			Expected: []string{},
+		},
+		{
+			Name:     "words after -- aren't flags",
+			Words:    []string{"marks", "jump", "--", "-"},
+			Expected: []string{},
+		},
+		{
+			Name:     "commands of the current project",
+			Words:    []string{"run", ""},
+			Expected: []string{"build", "test"},
+		},
+		{
+			Name:     "commands of the --directory project",
+			Words:    []string{"run", "--directory", "../b", ""},
+			Expected: []string{"deploy", "lint"},
+		},
+		{
+			Name:     "commands of the --directory= project",
+			Words:    []string{"run", "--directory=" + filepath.Join(root, "b"), ""},
+			Expected: []string{"deploy", "lint"},
+		},
+		{
+			Name:     "commands of the --directory project split by bash",
+			Words:    []string{"run", "--directory", "=", "~/c", ""},
+			Expected: []string{"serve"},
+		},
+		{
+			Name:     "directories",
+			Words:    []string{"run", "--directory", "../"},
+			Expected: []string{"../a/", "../b/", "../config/", "../home/"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			require.Equal(t, test.Expected, complete(ctx, parser.Model.Node, test.Words))
+		})
+	}
+}
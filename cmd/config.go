@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type ConfigValidateCmd struct{}
+
+func (cmd *ConfigValidateCmd) Run(ctx *Context) error {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return err
+	}
+
+	_, issues, err := ctx.Service.ValidateProjectConfig(dir)
+	if err != nil {
+		return err
+	}
+
+	valid := true
+	for _, issue := range issues {
+		if !issue.Warning {
+			valid = false
+		}
+
+		if _, err := fmt.Fprintln(ctx.Stdout, issue); err != nil {
+			return err
+		}
+	}
+
+	if !valid {
+		return errors.New("config is invalid")
+	}
+
+	return nil
+}
+
+type ConfigConvertCmd struct {
+	To string `required:"" enum:"json,yaml,toml" help:"The format to convert to (${enum})"`
+}
+
+func (cmd *ConfigConvertCmd) Run(ctx *Context) error {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return err
+	}
+
+	path, err := ctx.Service.ConvertProjectConfig(dir, cmd.To)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(ctx.Stdout, path)
+	return err
+}
+
+type ConfigShowCmd struct {
+	Resolved    bool     `help:"Show where each value in the config came from"`
+	Fields      []string `default:"key,value,source" enum:"${fields}"`
+	OutputFlags `embed:""`
+}
+
+func (cmd *ConfigShowCmd) Run(ctx *Context) error {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return err
+	}
+
+	cfg, values, err := ctx.Service.ResolveProjectConfig(dir)
+	if err != nil {
+		return err
+	}
+
+	if !cmd.Resolved {
+		data, err := json.MarshalIndent(cfg, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(ctx.Stdout, string(data))
+		return err
+	}
+
+	formatter, err := cmd.Formatter(cmd.Fields, ctx.Stdout)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		data := map[string]any{
+			"key":    value.Key,
+			"value":  value.Value,
+			"source": ctx.UnexpandPath(value.Source),
+		}
+
+		// Show values the same way they would be written in JSON config,
+		// unless the output is JSON anyway
+		if cmd.Format != "json" && cmd.Format != "json-array" {
+			encoded, err := json.Marshal(value.Value)
+			if err != nil {
+				return err
+			}
+
+			data["value"] = string(encoded)
+		}
+
+		if err := formatter.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return formatter.Close()
+}
+
+type ConfigCmd struct {
+	Validate ConfigValidateCmd `cmd:"" help:"Check the project config for errors"`
+	Convert  ConfigConvertCmd  `cmd:"" help:"Convert the project config to another format"`
+	Show     ConfigShowCmd     `cmd:"" set:"fields=key,value,source" help:"Show the project config after merging all the config files"`
+}
@@ -2,14 +2,17 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
-	"github.com/jamesbehr/torpedo/format"
 	"github.com/jamesbehr/torpedo/marks"
 )
 
 type FileMarksDelCmd struct {
-	Key string `arg:""`
+	Key string `arg:"" predictor:"file-marks"`
 }
 
 func (cmd *FileMarksDelCmd) Run(ctx *Context) error {
@@ -18,22 +21,25 @@ func (cmd *FileMarksDelCmd) Run(ctx *Context) error {
 		return err
 	}
 
-	marksPath := ctx.Service.ProjectDataFilePath(dir, "marks.json")
-	m, err := marks.ReadFileMarks(marksPath)
+	marksPath, _, err := ctx.Service.FileMarksPath(dir)
 	if err != nil {
 		return err
 	}
 
-	delete(m, cmd.Key)
-
-	return m.Write(marksPath)
+	return marks.UpdateFileMarks(marksPath, func(m marks.FileMarks) error {
+		delete(m, cmd.Key)
+		return nil
+	})
 }
 
 type FileMarksSetCmd struct {
-	Key    string `arg:""`
-	File   string `arg:""`
-	Line   uint64 `arg:""`
-	Column uint64 `arg:""`
+	Key      string   `arg:""`
+	File     string   `arg:""`
+	Line     uint64   `arg:""`
+	Column   uint64   `arg:""`
+	NoAnchor bool     `help:"Don't store the content around the mark, which is used to find it again after the file changes"`
+	Note     *string  `help:"A note describing the mark"`
+	Tags     []string `name:"tag" help:"Tags for the mark, which can be given more than once"`
 }
 
 func (cmd *FileMarksSetCmd) Run(ctx *Context) error {
@@ -42,34 +48,55 @@ func (cmd *FileMarksSetCmd) Run(ctx *Context) error {
 		return err
 	}
 
-	path, err := filepath.Abs(cmd.File)
+	path := cmd.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(ctx.WorkingDirectory, path)
+	}
+
+	rel, err := ctx.Service.FileMarkPath(dir, path)
 	if err != nil {
 		return err
 	}
 
-	rel, err := filepath.Rel(dir, path)
+	marksPath, _, err := ctx.Service.FileMarksPath(dir)
 	if err != nil {
 		return err
 	}
 
-	if !filepath.IsLocal(rel) {
-		return errors.New("file must be within the current project")
-	}
+	mark := marks.File(rel, cmd.Line, cmd.Column)
 
-	marksPath := ctx.Service.ProjectDataFilePath(dir, "marks.json")
-	m, err := marks.ReadFileMarks(marksPath)
-	if err != nil {
-		return err
+	// Marks can be set in files that don't exist yet, but they can't have
+	// an anchor
+	if !cmd.NoAnchor {
+		if lines, err := marks.ReadLines(path); err == nil {
+			mark.Anchor = marks.NewAnchor(lines, cmd.Line)
+		}
 	}
 
-	m[cmd.Key] = marks.File(cmd.File, cmd.Line, cmd.Column)
+	return marks.UpdateFileMarks(marksPath, func(m marks.FileMarks) error {
+		// Moving a mark keeps its note and tags, unless there are new ones
+		if old, ok := m[cmd.Key]; ok {
+			mark.Note, mark.Tags = old.Note, old.Tags
+		}
+
+		if cmd.Note != nil {
+			mark.Note = *cmd.Note
+		}
 
-	return m.Write(marksPath)
+		if cmd.Tags != nil {
+			mark.Tags = slices.DeleteFunc(cmd.Tags, func(tag string) bool { return tag == "" })
+		}
+
+		m[cmd.Key] = mark
+		return nil
+	})
 }
 
 type FileMarksListCmd struct {
-	Fields []string `default:"mark,line,col,file" enum:"mark,line,col,file,path"`
-	Format string   `default:"text"`
+	Fields      []string `default:"mark,line,col,file,stale" enum:"${fields}"`
+	OutputFlags `embed:""`
+	AllBranches bool   `help:"List the file marks of every branch, instead of the branch that is checked out"`
+	Tag         string `help:"Only list the file marks with this tag"`
 }
 
 func (cmd *FileMarksListCmd) Run(ctx *Context) error {
@@ -78,36 +105,447 @@ func (cmd *FileMarksListCmd) Run(ctx *Context) error {
 		return err
 	}
 
-	marksPath := ctx.Service.ProjectDataFilePath(dir, "marks.json")
-	m, err := marks.ReadFileMarks(marksPath)
+	path, current, err := ctx.Service.FileMarksPath(dir)
 	if err != nil {
 		return err
 	}
 
-	formatter, err := format.New(cmd.Format, cmd.Fields, ctx.Stdout)
+	branches := []string{current}
+	fields := cmd.Fields
+
+	if cmd.AllBranches {
+		enabled, err := ctx.Service.BranchFileMarks(dir)
+		if err != nil {
+			return err
+		}
+
+		if !enabled {
+			return errors.New("file marks aren't kept for each branch, set branch_file_marks in the project config")
+		}
+
+		branches, err = ctx.Service.FileMarksBranches(dir)
+		if err != nil {
+			return err
+		}
+
+		if !slices.Contains(fields, "branch") {
+			fields = append([]string{"branch"}, fields...)
+		}
+	}
+
+	formatter, err := cmd.LocationFormatter(fields, ctx.Stdout)
 	if err != nil {
 		return err
 	}
 
-	for key, value := range m {
-		data := map[string]any{
-			"mark": key,
-			"col":  value.Column,
-			"line": value.Line,
-			"file": value.Path,
-			"path": filepath.Join(dir, value.Path),
+	for _, branch := range branches {
+		var m marks.FileMarks
+		var stale map[string]bool
+
+		// The files on other branches aren't checked out, so their marks
+		// can't be moved to where their content is
+		if branch == current {
+			m, stale, err = readFileMarks(dir, path)
+		} else {
+			m, err = marks.ReadFileMarks(ctx.Service.BranchFileMarksPath(dir, branch))
+		}
+
+		if err != nil {
+			return err
 		}
 
-		if err := formatter.Write(data); err != nil {
+		for _, key := range m.Keys() {
+			if cmd.Tag != "" && !slices.Contains(m[key].Tags, cmd.Tag) {
+				continue
+			}
+
+			if err := formatter.Write(fileMarkData(dir, branch, key, m[key], stale[key])); err != nil {
+				return err
+			}
+		}
+	}
+
+	return formatter.Close()
+}
+
+// readFileMarks reads the file marks of the project in dir from path, moved
+// to where their anchors are now, and which of them are stale.
+func readFileMarks(dir, path string) (marks.FileMarks, map[string]bool, error) {
+	m, err := marks.ReadFileMarks(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stale := map[string]bool{}
+
+	for key, mark := range m {
+		mark, ok := mark.Relocate(dir)
+		m[key] = mark
+		stale[key] = !ok
+	}
+
+	return m, stale, nil
+}
+
+func fileMarkData(dir, branch, key string, mark marks.FileMark, stale bool) map[string]any {
+	tags := mark.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return map[string]any{
+		"branch": branch,
+		"mark":   key,
+		"col":    mark.Column,
+		"line":   mark.Line,
+		"file":   mark.Path,
+		"path":   filepath.Join(dir, mark.Path),
+		"stale":  stale,
+		"note":   mark.Note,
+		"tags":   tags,
+	}
+}
+
+type FileMarksNextCmd struct {
+	File        string   `arg:"" optional:"" help:"The file open in the editor, which is used to find the current mark"`
+	Line        uint64   `help:"The line of the cursor in the file, to choose between marks in the same file"`
+	Fields      []string `default:"path,line,col" enum:"${fields}"`
+	OutputFlags `embed:""`
+}
+
+func (cmd *FileMarksNextCmd) Run(ctx *Context) error {
+	return stepFileMarks(ctx, 1, cmd.File, cmd.Line, cmd.Fields, &cmd.OutputFlags)
+}
+
+type FileMarksPrevCmd struct {
+	File        string   `arg:"" optional:"" help:"The file open in the editor, which is used to find the current mark"`
+	Line        uint64   `help:"The line of the cursor in the file, to choose between marks in the same file"`
+	Fields      []string `default:"path,line,col" enum:"${fields}"`
+	OutputFlags `embed:""`
+}
+
+func (cmd *FileMarksPrevCmd) Run(ctx *Context) error {
+	return stepFileMarks(ctx, -1, cmd.File, cmd.Line, cmd.Fields, &cmd.OutputFlags)
+}
+
+// stepFileMarks prints the file mark that is delta places after the mark for
+// the position in the editor.
+// The current mark is the one at the line in file if there is one, or else
+// the first mark in file.
+func stepFileMarks(ctx *Context, delta int, file string, line uint64, fields []string, output *OutputFlags) error {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return err
+	}
+
+	path, branch, err := ctx.Service.FileMarksPath(dir)
+	if err != nil {
+		return err
+	}
+
+	m, stale, err := readFileMarks(dir, path)
+	if err != nil {
+		return err
+	}
+
+	current := ""
+
+	if file != "" {
+		path, err := filepath.Abs(file)
+		if err != nil {
 			return err
 		}
+
+		for _, key := range m.Keys() {
+			mark := m[key]
+			if filepath.Join(dir, mark.Path) != path {
+				continue
+			}
+
+			if current == "" {
+				current = key
+			}
+
+			if line != 0 && mark.Line == line {
+				current = key
+				break
+			}
+		}
+	}
+
+	key, ok := m.Step(current, delta)
+	if !ok {
+		return errors.New("there are no file marks")
+	}
+
+	formatter, err := output.LocationFormatter(fields, ctx.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if err := formatter.Write(fileMarkData(dir, branch, key, m[key], stale[key])); err != nil {
+		return err
 	}
 
 	return formatter.Close()
 }
 
+type FileMarksJumpCmd struct {
+	Key string `arg:"" predictor:"file-marks"`
+}
+
+func (cmd *FileMarksJumpCmd) Run(ctx *Context) error {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return err
+	}
+
+	path, _, err := ctx.Service.FileMarksPath(dir)
+	if err != nil {
+		return err
+	}
+
+	m, _, err := readFileMarks(dir, path)
+	if err != nil {
+		return err
+	}
+
+	// A stale mark is opened where it was, since the file could still be
+	// there with the marked line changed
+	mark, ok := m[cmd.Key]
+	if !ok {
+		return fmt.Errorf("no such file mark %q", cmd.Key)
+	}
+
+	// Use the session that the user is in if it is for the project, since
+	// it could be for a layout profile
+	sessionName := ctx.UnexpandPath(dir)
+	if current, err := ctx.Service.CurrentSession(); err == nil {
+		if path, ok := ctx.SessionProject(current); ok && path == dir {
+			sessionName = current
+		}
+	}
+
+	exists, err := ctx.Service.HasSession(sessionName)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return errors.New("the project has no session to open the file in, open it with torpedo pick first")
+	}
+
+	pane, err := ctx.Service.FindEditorPane(sessionName)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Service.OpenInEditor(sessionName, pane, filepath.Join(dir, mark.Path), mark.Line, mark.Column)
+}
+
+type FileMarksFixCmd struct{}
+
+func (cmd *FileMarksFixCmd) Run(ctx *Context) error {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return err
+	}
+
+	marksPath, _, err := ctx.Service.FileMarksPath(dir)
+	if err != nil {
+		return err
+	}
+
+	return marks.UpdateFileMarks(marksPath, func(m marks.FileMarks) error {
+		for _, key := range m.Keys() {
+			mark, ok := m[key].Relocate(dir)
+			if !ok {
+				fmt.Fprintf(ctx.Stdout, "%s: %s is stale, its content can't be found\n", key, mark)
+				continue
+			}
+
+			if mark.Line != m[key].Line {
+				fmt.Fprintf(ctx.Stdout, "%s: moved from line %d to %d in %s\n", key, m[key].Line, mark.Line, mark.Path)
+			}
+
+			m[key] = mark
+		}
+
+		return nil
+	})
+}
+
+type FileMarksCopyCmd struct {
+	From  string   `required:"" predictor:"branches" help:"The branch to copy the file marks from"`
+	Keys  []string `arg:"" optional:"" help:"The file marks to copy, or all of them if none are given"`
+	Force bool     `help:"Replace file marks that the current branch already has"`
+}
+
+func (cmd *FileMarksCopyCmd) Run(ctx *Context) error {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return err
+	}
+
+	marksPath, branch, err := ctx.Service.FileMarksPath(dir)
+	if err != nil {
+		return err
+	}
+
+	if branch == "" {
+		return errors.New("file marks can only be copied to a branch, set branch_file_marks in the project config and check out a branch")
+	}
+
+	if cmd.From == branch {
+		return fmt.Errorf("branch %q is already checked out", branch)
+	}
+
+	fromPath := ctx.Service.BranchFileMarksPath(dir, cmd.From)
+	if _, err := os.Stat(fromPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("branch %q has no file marks", cmd.From)
+		}
+
+		return err
+	}
+
+	from, err := marks.ReadFileMarks(fromPath)
+	if err != nil {
+		return err
+	}
+
+	keys := cmd.Keys
+	if len(keys) == 0 {
+		keys = from.Keys()
+	}
+
+	return marks.UpdateFileMarks(marksPath, func(m marks.FileMarks) error {
+		for _, key := range keys {
+			mark, ok := from[key]
+			if !ok {
+				return fmt.Errorf("branch %q has no file mark %q", cmd.From, key)
+			}
+
+			if _, exists := m[key]; exists && !cmd.Force {
+				return fmt.Errorf("file mark %q already exists, use --force to replace it", key)
+			}
+
+			m[key] = mark
+		}
+
+		return nil
+	})
+}
+
+type FileMarksDoctorCmd struct {
+	DryRun bool `help:"Only report problems, without fixing the file marks"`
+}
+
+func (cmd *FileMarksDoctorCmd) Run(ctx *Context) error {
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return err
+	}
+
+	marksPath, _, err := ctx.Service.FileMarksPath(dir)
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+
+	check := func(m marks.FileMarks) error {
+		for _, key := range m.Keys() {
+			mark := m[key]
+
+			fixed, err := fixFileMarkPath(ctx, dir, mark.Path)
+			if err != nil {
+				problems++
+				fmt.Fprintf(ctx.Stdout, "%s: %s\n", key, err)
+				continue
+			}
+
+			if fixed != mark.Path {
+				change := "is now"
+				if cmd.DryRun {
+					change = "should be"
+				}
+
+				fmt.Fprintf(ctx.Stdout, "%s: %s %s %s\n", key, mark.Path, change, fixed)
+				mark.Path = fixed
+				m[key] = mark
+			}
+		}
+
+		return nil
+	}
+
+	if cmd.DryRun {
+		m, err := marks.ReadFileMarks(marksPath)
+		if err != nil {
+			return err
+		}
+
+		err = check(m)
+	} else {
+		err = marks.UpdateFileMarks(marksPath, check)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("can't fix %d of the file marks, delete them with torpedo file-marks rm", problems)
+	}
+
+	return nil
+}
+
+// fixFileMarkPath returns the clean project relative path for the file of a
+// mark, which could be from before file marks were stored that way.
+// Marks used to store the path they were set with, which was relative to the
+// directory they were set in, so missing files are looked for in the
+// subdirectories of the project.
+func fixFileMarkPath(ctx *Context, dir, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	rel, err := ctx.Service.FileMarkPath(dir, path)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, rel)); err == nil {
+		return rel, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	found, err := ctx.Service.FindProjectFiles(dir, rel)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("%s does not exist", rel)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("%s does not exist, and it could be any of %s", rel, strings.Join(found, ", "))
+	}
+}
+
 type FileMarksCmd struct {
-	Set  FileMarksSetCmd  `cmd:"" help:"Set a file mark"`
-	Del  FileMarksDelCmd  `cmd:"" help:"Delete a file mark"`
-	List FileMarksListCmd `cmd:"" help:"List your file marks"`
+	Set    FileMarksSetCmd    `cmd:"" help:"Set a file mark"`
+	Del    FileMarksDelCmd    `cmd:"" aliases:"rm" help:"Delete a file mark"`
+	List   FileMarksListCmd   `cmd:"" set:"fields=branch,mark,line,col,file,path,stale,note,tags" set:"locations=true" help:"List your file marks, which can also be written in the ${location_formats} formats"`
+	Jump   FileMarksJumpCmd   `cmd:"" help:"Open a file mark in the editor pane of the project's session"`
+	Next   FileMarksNextCmd   `cmd:"" set:"fields=branch,mark,line,col,file,path,stale,note,tags" set:"locations=true" help:"Print the file mark after the current one, which can also be written in the ${location_formats} formats"`
+	Prev   FileMarksPrevCmd   `cmd:"" set:"fields=branch,mark,line,col,file,path,stale,note,tags" set:"locations=true" help:"Print the file mark before the current one, which can also be written in the ${location_formats} formats"`
+	Fix    FileMarksFixCmd    `cmd:"" help:"Move file marks to where their content is now"`
+	Copy   FileMarksCopyCmd   `cmd:"" aliases:"cp" help:"Copy file marks from another branch to the current one"`
+	Doctor FileMarksDoctorCmd `cmd:"" help:"Find file marks whose files are missing, and fix marks stored the old way"`
 }
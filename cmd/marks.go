@@ -1,39 +1,94 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"strings"
 
-	"github.com/jamesbehr/torpedo/format"
+	"github.com/jamesbehr/torpedo/core"
 	"github.com/jamesbehr/torpedo/marks"
 )
 
 type MarksDelCmd struct {
-	Key string `arg:""`
+	Key string `arg:"" predictor:"marks"`
 }
 
 func (cmd *MarksDelCmd) Run(ctx *Context) error {
-	path := ctx.ConfigFilePath("marks.json")
+	return marks.UpdateMarks(ctx.ConfigFilePath("marks.json"), func(m *marks.Marks) error {
+		m.Delete(cmd.Key)
+		return nil
+	})
+}
 
-	m, err := marks.ReadMarks(path)
-	if err != nil {
+type MarksSetCmd struct {
+	Key string `arg:""`
+}
+
+func (cmd *MarksSetCmd) Run(ctx *Context) error {
+	if err := core.CheckMarkKey(cmd.Key); err != nil {
 		return err
 	}
 
-	delete(m, cmd.Key)
+	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
+	if err != nil {
+		return err
+	}
 
-	return m.Write(path)
+	return marks.UpdateMarks(ctx.ConfigFilePath("marks.json"), func(m *marks.Marks) error {
+		m.Set(cmd.Key, ctx.UnexpandPath(dir))
+		return nil
+	})
 }
 
-type MarksSetCmd struct {
-	Key string `arg:""`
-}
+type MarksAddCmd struct{}
 
-func (cmd *MarksSetCmd) Run(ctx *Context) error {
+func (cmd *MarksAddCmd) Run(ctx *Context) error {
 	dir, err := ctx.Service.FindCurrentProject(ctx.WorkingDirectory)
 	if err != nil {
 		return err
 	}
 
+	var key string
+
+	err = marks.UpdateMarks(ctx.ConfigFilePath("marks.json"), func(m *marks.Marks) error {
+		key = m.Add(ctx.UnexpandPath(dir))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(ctx.Stdout, key)
+	return err
+}
+
+type MarksSwapCmd struct {
+	A string `arg:"" predictor:"marks"`
+	B string `arg:"" predictor:"marks"`
+}
+
+func (cmd *MarksSwapCmd) Run(ctx *Context) error {
+	return marks.UpdateMarks(ctx.ConfigFilePath("marks.json"), func(m *marks.Marks) error {
+		return m.Swap(cmd.A, cmd.B)
+	})
+}
+
+type MarksMoveCmd struct {
+	Key      string `arg:"" predictor:"marks"`
+	Position int    `arg:"" help:"The new position of the mark, where 1 is the top of the list"`
+}
+
+func (cmd *MarksMoveCmd) Run(ctx *Context) error {
+	return marks.UpdateMarks(ctx.ConfigFilePath("marks.json"), func(m *marks.Marks) error {
+		return m.Move(cmd.Key, cmd.Position-1)
+	})
+}
+
+type MarksMenuCmd struct{}
+
+func (cmd *MarksMenuCmd) Run(ctx *Context) error {
 	path := ctx.ConfigFilePath("marks.json")
 
 	m, err := marks.ReadMarks(path)
@@ -41,14 +96,59 @@ func (cmd *MarksSetCmd) Run(ctx *Context) error {
 		return err
 	}
 
-	m[cmd.Key] = ctx.UnexpandPath(dir)
+	f, err := os.CreateTemp("", "torpedo-marks-*.txt")
+	if err != nil {
+		return err
+	}
 
-	return m.Write(path)
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(core.FormatMarksMenu(m)); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+
+	// The editor can have arguments, like "code --wait"
+	editorCmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	editorCmd.Stdin = os.Stdin
+	editorCmd.Stdout = os.Stdout
+	editorCmd.Stderr = os.Stderr
+
+	if err := editorCmd.Run(); err != nil {
+		return fmt.Errorf("editor failed, marks were not changed: %w", err)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+
+	edited, err := core.ParseMarksMenu(data)
+	if err != nil {
+		return err
+	}
+
+	// The marks aren't locked while they are being edited, since that would
+	// stop keybindings from changing them, so changes made in the meantime
+	// are replaced
+	return marks.UpdateMarks(path, func(m *marks.Marks) error {
+		*m = edited
+		return nil
+	})
 }
 
 type MarksListCmd struct {
-	Fields []string `default:"mark,project" enum:"mark,path,project"`
-	Format string   `default:"text"`
+	Fields      []string `default:"mark,project" enum:"${fields}"`
+	OutputFlags `embed:""`
 }
 
 func (cmd *MarksListCmd) Run(ctx *Context) error {
@@ -59,16 +159,16 @@ func (cmd *MarksListCmd) Run(ctx *Context) error {
 		return err
 	}
 
-	formatter, err := format.New(cmd.Format, cmd.Fields, ctx.Stdout)
+	formatter, err := cmd.Formatter(cmd.Fields, ctx.Stdout)
 	if err != nil {
 		return err
 	}
 
-	for key, value := range m {
+	for _, mark := range m {
 		data := map[string]any{
-			"mark":    key,
-			"project": value,
-			"path":    ctx.ExpandPath(value),
+			"mark":    mark.Key,
+			"project": mark.Project,
+			"path":    ctx.ExpandPath(mark.Project),
 		}
 
 		if err := formatter.Write(data); err != nil {
@@ -80,7 +180,9 @@ func (cmd *MarksListCmd) Run(ctx *Context) error {
 }
 
 type MarksJumpCmd struct {
-	Key string `arg:""`
+	Key    string `arg:"" predictor:"marks"`
+	Layout string `help:"The layout profile to open the project with"`
+	Switch bool   `help:"Switch the layout of the project's session instead of opening a separate session"`
 }
 
 func (cmd *MarksJumpCmd) Run(ctx *Context) error {
@@ -91,37 +193,63 @@ func (cmd *MarksJumpCmd) Run(ctx *Context) error {
 		return err
 	}
 
-	value, ok := m[cmd.Key]
+	value, ok := m.Get(cmd.Key)
 	if !ok {
 		return fmt.Errorf("no such mark %q", cmd.Key)
 	}
 
-	projectDir := ctx.ExpandPath(value)
+	return ctx.OpenProject(ctx.ExpandPath(value), cmd.Layout, cmd.Switch)
+}
 
-	cfg, err := ctx.Service.ParseProjectConfig(projectDir)
-	if err != nil {
-		return err
-	}
+type MarksNextCmd struct {
+	Layout string `help:"The layout profile to open the project with"`
+	Switch bool   `help:"Switch the layout of the project's session instead of opening a separate session"`
+}
+
+func (cmd *MarksNextCmd) Run(ctx *Context) error {
+	return stepMarks(ctx, 1, cmd.Layout, cmd.Switch)
+}
 
-	sessionName := ctx.UnexpandPath(projectDir)
+type MarksPrevCmd struct {
+	Layout string `help:"The layout profile to open the project with"`
+	Switch bool   `help:"Switch the layout of the project's session instead of opening a separate session"`
+}
 
-	exists, err := ctx.Service.HasSession(sessionName)
+func (cmd *MarksPrevCmd) Run(ctx *Context) error {
+	return stepMarks(ctx, -1, cmd.Layout, cmd.Switch)
+}
+
+// stepMarks jumps to the mark that is delta places after the mark for the
+// current project.
+func stepMarks(ctx *Context, delta int, layout string, switchLayout bool) error {
+	m, err := marks.ReadMarks(ctx.ConfigFilePath("marks.json"))
 	if err != nil {
 		return err
 	}
 
-	if !exists {
-		if err := ctx.Service.CreateSession(sessionName, projectDir, cfg.Windows); err != nil {
-			return err
-		}
+	// Outside of a project, the first or last mark is used
+	project := ""
+	if dir, err := ctx.CurrentProject(); err == nil {
+		project = ctx.UnexpandPath(dir)
+	}
+
+	mark, ok := m.Step(project, delta)
+	if !ok {
+		return errors.New("there are no marks")
 	}
 
-	return ctx.Service.AttachSession(sessionName)
+	return ctx.OpenProject(ctx.ExpandPath(mark.Project), layout, switchLayout)
 }
 
 type MarksCmd struct {
 	Set  MarksSetCmd  `cmd:"" help:"Set a mark"`
+	Add  MarksAddCmd  `cmd:"" help:"Mark the current project with the next free number"`
 	Del  MarksDelCmd  `cmd:"" help:"Delete a mark"`
-	List MarksListCmd `cmd:"" help:"List your marks"`
+	List MarksListCmd `cmd:"" set:"fields=mark,path,project" help:"List your marks"`
 	Jump MarksJumpCmd `cmd:"" help:"Jump to a marked project by index"`
+	Next MarksNextCmd `cmd:"" help:"Jump to the mark after the current project"`
+	Prev MarksPrevCmd `cmd:"" help:"Jump to the mark before the current project"`
+	Swap MarksSwapCmd `cmd:"" help:"Swap the projects of two marks"`
+	Move MarksMoveCmd `cmd:"" help:"Move a mark to another position in the list"`
+	Menu MarksMenuCmd `cmd:"" help:"Edit your marks in $EDITOR"`
 }
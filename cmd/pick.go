@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jamesbehr/torpedo/marks"
+	"github.com/jamesbehr/torpedo/picker"
+)
+
+// The kinds of items that torpedo pick can open.
+const (
+	kindProject = "project"
+	kindSession = "session"
+	kindWindow  = "window"
+	kindMark    = "mark"
+)
+
+type PickCmd struct {
+	Paths   []string `predictor:"dirs"`
+	Source  []string `default:"projects" enum:"projects,sessions,windows,marks" help:"What to pick from, which can be more than one of ${enum}"`
+	Layout  string   `help:"The layout profile to open the project with"`
+	Switch  bool     `help:"Switch the layout of the project's session instead of opening a separate session"`
+	Preview bool     `default:"true" negatable:"" help:"Show a preview of the project under the cursor, if the picker is fzf or skim"`
+}
+
+func (cmd *PickCmd) Run(ctx *Context) error {
+	items, err := cmd.items(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Projects are listed as just their paths when they are the only source,
+	// like they always used to be
+	prefixed := !slices.Equal(cmd.Source, []string{"projects"})
+
+	labels := make([]string, len(items))
+	byLabel := map[string]pickItem{}
+
+	for i, item := range items {
+		labels[i] = ctx.UnexpandPath(item.Project)
+		if prefixed {
+			labels[i] = item.label(ctx)
+		}
+
+		byLabel[labels[i]] = item
+	}
+
+	opts := picker.Options{}
+	if cmd.Preview {
+		executable, err := os.Executable()
+		if err != nil {
+			return err
+		}
+
+		opts.Preview = []string{executable, "preview"}
+		if prefixed {
+			opts.Preview = append(opts.Preview, "--item")
+		}
+	}
+
+	choice, err := picker.Pick(labels, opts)
+	if err != nil {
+		return err
+	}
+
+	item := byLabel[choice]
+
+	switch item.Kind {
+	case kindSession:
+		return ctx.Service.AttachSession(item.Session)
+	case kindWindow:
+		return ctx.Service.AttachWindow(item.Session, item.Window)
+	default:
+		return ctx.OpenProject(item.Project, cmd.Layout, cmd.Switch)
+	}
+}
+
+// pickItem is something that torpedo pick can open.
+type pickItem struct {
+	Kind string
+	// Project is the directory of a project or mark.
+	Project string
+	// Session is the name of a session or the session of a window.
+	Session string
+	// Window is the index of a window, and WindowName is its name.
+	Window     string
+	WindowName string
+	// Mark is the key of a mark.
+	Mark string
+}
+
+// label returns how the item is shown in the picker, with its kind first.
+func (item pickItem) label(ctx *Context) string {
+	var value string
+
+	switch item.Kind {
+	case kindSession:
+		value = item.Session
+	case kindWindow:
+		value = fmt.Sprintf("%s:%s %s", item.Session, item.Window, item.WindowName)
+	case kindMark:
+		value = item.Mark + " " + ctx.UnexpandPath(item.Project)
+	default:
+		value = ctx.UnexpandPath(item.Project)
+	}
+
+	return fmt.Sprintf("%-7s %s", item.Kind, value)
+}
+
+// parsePickItem turns a label from [pickItem.label] back into an item.
+// Window names and mark projects can contain spaces, but Tmux doesn't allow
+// colons in session names and mark keys can't contain spaces, so the label
+// can always be split up.
+func parsePickItem(ctx *Context, label string) (pickItem, error) {
+	kind, value, _ := strings.Cut(label, " ")
+	value = strings.TrimLeft(value, " ")
+	if value == "" {
+		return pickItem{}, fmt.Errorf("invalid item %q", label)
+	}
+
+	switch kind {
+	case kindProject:
+		return pickItem{Kind: kind, Project: ctx.ExpandPath(value)}, nil
+	case kindSession:
+		return pickItem{Kind: kind, Session: value}, nil
+	case kindWindow:
+		session, window, ok := strings.Cut(value, ":")
+		if !ok {
+			break
+		}
+
+		index, name, _ := strings.Cut(window, " ")
+		return pickItem{Kind: kind, Session: session, Window: index, WindowName: name}, nil
+	case kindMark:
+		key, project, ok := strings.Cut(value, " ")
+		if !ok {
+			break
+		}
+
+		return pickItem{Kind: kind, Mark: key, Project: ctx.ExpandPath(project)}, nil
+	}
+
+	return pickItem{}, fmt.Errorf("invalid item %q", label)
+}
+
+// items returns the items from each source, in the order of the sources.
+func (cmd *PickCmd) items(ctx *Context) ([]pickItem, error) {
+	items := []pickItem{}
+
+	for _, source := range cmd.Source {
+		switch source {
+		case "projects":
+			projects, err := ctx.Service.FindProjects(cmd.Paths)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, project := range projects {
+				items = append(items, pickItem{Kind: kindProject, Project: project})
+			}
+		case "sessions", "windows":
+			sessions, err := ctx.Service.ListSessions()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, session := range sessions {
+				if source == "sessions" {
+					items = append(items, pickItem{Kind: kindSession, Session: session.Name})
+					continue
+				}
+
+				windows, err := ctx.Service.ListWindows(session.Name)
+				if err != nil {
+					return nil, err
+				}
+
+				for _, window := range windows {
+					items = append(items, pickItem{
+						Kind:       kindWindow,
+						Session:    session.Name,
+						Window:     window.Index,
+						WindowName: window.Name,
+					})
+				}
+			}
+		case "marks":
+			m, err := marks.ReadMarks(ctx.ConfigFilePath("marks.json"))
+			if err != nil {
+				return nil, err
+			}
+
+			for _, mark := range m {
+				items = append(items, pickItem{Kind: kindMark, Mark: mark.Key, Project: ctx.ExpandPath(mark.Project)})
+			}
+		}
+	}
+
+	return items, nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickItemLabel(t *testing.T) {
+	ctx := &Context{Home: "/home/user"}
+
+	tests := []struct {
+		Name     string
+		Item     pickItem
+		Expected string
+	}{
+		{
+			Name:     "project",
+			Item:     pickItem{Kind: kindProject, Project: "/home/user/my project"},
+			Expected: "project ~/my project",
+		},
+		{
+			Name:     "project outside home",
+			Item:     pickItem{Kind: kindProject, Project: "/srv/app"},
+			Expected: "project /srv/app",
+		},
+		{
+			Name:     "session",
+			Item:     pickItem{Kind: kindSession, Session: "~/my project"},
+			Expected: "session ~/my project",
+		},
+		{
+			Name:     "window",
+			Item:     pickItem{Kind: kindWindow, Session: "~/app", Window: "2", WindowName: "go test  ./..."},
+			Expected: "window  ~/app:2 go test  ./...",
+		},
+		{
+			Name:     "window without a name",
+			Item:     pickItem{Kind: kindWindow, Session: "~/app", Window: "10"},
+			Expected: "window  ~/app:10 ",
+		},
+		{
+			Name:     "mark",
+			Item:     pickItem{Kind: kindMark, Mark: "1", Project: "/home/user/my project"},
+			Expected: "mark    1 ~/my project",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			label := test.Item.label(ctx)
+			require.Equal(t, test.Expected, label)
+
+			item, err := parsePickItem(ctx, label)
+			require.NoError(t, err)
+			require.Equal(t, test.Item, item)
+		})
+	}
+
+	for _, label := range []string{"", "project", "window  app", "mark    1", "other x"} {
+		_, err := parsePickItem(ctx, label)
+		require.Error(t, err, "parsePickItem(%q)", label)
+	}
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"github.com/jamesbehr/torpedo/core"
+)
+
+type PreviewCmd struct {
+	Project string `arg:"" predictor:"dirs" help:"The project directory, which can start with ~"`
+	Lines   int    `default:"20" help:"The number of lines of the README to show"`
+	Item    bool   `hidden:"" help:"The project is an item from torpedo pick, which could also be a session, window or mark"`
+}
+
+// Run shows as much as it can about the project, since a preview that fails
+// part way is less useful than one with some parts missing.
+func (cmd *PreviewCmd) Run(ctx *Context) error {
+	dir := ctx.ExpandPath(cmd.Project)
+	w := ctx.Stdout
+
+	if cmd.Item {
+		item, err := parsePickItem(ctx, cmd.Project)
+		if err != nil {
+			return err
+		}
+
+		dir = item.Project
+
+		// Sessions that weren't opened by torpedo only have their windows to
+		// show
+		if item.Session != "" {
+			project, ok := ctx.SessionProject(item.Session)
+			if !ok {
+				fmt.Fprintln(w, item.Session)
+				previewSessions(ctx, w, func(name string) bool { return name == item.Session })
+				return nil
+			}
+
+			dir = project
+		}
+	}
+
+	fmt.Fprintln(w, ctx.UnexpandPath(dir))
+
+	if changes, err := core.GitStatus(dir); err == nil {
+		branch, _ := core.GitBranch(dir)
+		if branch == "" {
+			branch = "detached HEAD"
+		}
+
+		switch len(changes) {
+		case 0:
+			fmt.Fprintf(w, "Git: %s, clean\n", branch)
+		case 1:
+			fmt.Fprintf(w, "Git: %s, 1 changed file\n", branch)
+		default:
+			fmt.Fprintf(w, "Git: %s, %d changed files\n", branch, len(changes))
+		}
+	}
+
+	previewSessions(ctx, w, func(name string) bool {
+		project, ok := ctx.SessionProject(name)
+		return ok && project == dir
+	})
+	previewCommands(ctx, w, dir)
+
+	name, lines, err := core.ReadReadme(dir, cmd.Lines)
+	if err == nil && name != "" {
+		fmt.Fprintf(w, "\n%s\n", name)
+
+		for _, line := range lines {
+			fmt.Fprintln(w, strings.TrimRight("  "+line, " "))
+		}
+	}
+
+	return nil
+}
+
+// previewSessions shows the sessions that match, and their windows.
+// For a project, these are its session and the sessions for its layout
+// profiles.
+func previewSessions(ctx *Context, w io.Writer, match func(name string) bool) {
+	sessions, err := ctx.Service.ListSessions()
+	if err != nil {
+		return
+	}
+
+	found := false
+
+	for _, session := range sessions {
+		if !match(session.Name) {
+			continue
+		}
+
+		if !found {
+			fmt.Fprintln(w, "\nSessions")
+			found = true
+		}
+
+		status := "detached"
+		if session.Attached {
+			status = "attached"
+		}
+
+		fmt.Fprintf(w, "  %s (%s)\n", session.Name, status)
+
+		windows, err := ctx.Service.ListWindows(session.Name)
+		if err != nil {
+			continue
+		}
+
+		for _, window := range windows {
+			active := ""
+			if window.Active {
+				active = " *"
+			}
+
+			fmt.Fprintf(w, "    %s: %s%s\n", window.Index, window.Name, active)
+		}
+	}
+
+	if !found {
+		fmt.Fprintln(w, "\nNo session")
+	}
+}
+
+// previewCommands shows the commands in the project config.
+func previewCommands(ctx *Context, w io.Writer, dir string) {
+	cfg, err := ctx.Service.ParseProjectConfig(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintf(w, "\nThe config can't be read: %s\n", err)
+		return
+	}
+
+	if len(cfg.Commands) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(cfg.Commands))
+	width := 0
+
+	for name := range cfg.Commands {
+		names = append(names, name)
+		width = max(width, len(name))
+	}
+
+	slices.Sort(names)
+
+	fmt.Fprintln(w, "\nCommands")
+
+	for _, name := range names {
+		line := fmt.Sprintf("  %-*s  %s", width, name, cfg.Commands[name].Description)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
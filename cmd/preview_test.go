@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jamesbehr/torpedo/core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewCommands(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Config   string
+		Expected string
+		Error    bool
+	}{
+		{
+			Name:     "no config",
+			Expected: "",
+		},
+		{
+			Name:     "no commands",
+			Config:   `{}`,
+			Expected: "",
+		},
+		{
+			Name:     "commands",
+			Config:   `{"commands": {"test": {"run": "go test", "description": "Run the tests"}, "build": "go build"}}`,
+			Expected: "\nCommands\n  build\n  test   Run the tests\n",
+		},
+		{
+			Name:   "invalid config",
+			Config: `{"commands": 1}`,
+			Error:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			if test.Config != "" {
+				require.NoError(t, os.Mkdir(filepath.Join(dir, ".torpedo"), 0o755))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, ".torpedo", "config.json"), []byte(test.Config), 0o644))
+			}
+
+			ctx := &Context{Service: core.New(t.TempDir())}
+
+			var w strings.Builder
+			previewCommands(ctx, &w, dir)
+
+			if test.Error {
+				require.True(t, strings.HasPrefix(w.String(), "\nThe config can't be read: "), "output %q", w.String())
+				return
+			}
+
+			require.Equal(t, test.Expected, w.String())
+		})
+	}
+}
@@ -0,0 +1,1155 @@
+package core
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ConfigIssue is a problem found while validating a project config file.
+// Warnings do not prevent the config from being used.
+type ConfigIssue struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+	Warning bool
+}
+
+func (issue ConfigIssue) String() string {
+	location := issue.File
+	if issue.Line > 0 {
+		location += fmt.Sprintf(":%d", issue.Line)
+
+		if issue.Column > 0 {
+			location += fmt.Sprintf(":%d", issue.Column)
+		}
+	}
+
+	if issue.Warning {
+		return fmt.Sprintf("%s: warning: %s", location, issue.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", location, issue.Message)
+}
+
+// InvalidConfigError is returned when a project config file has issues that
+// are not just warnings.
+type InvalidConfigError struct {
+	Issues []ConfigIssue
+}
+
+func (err *InvalidConfigError) Error() string {
+	lines := []string{}
+	for _, issue := range err.Issues {
+		if !issue.Warning {
+			lines = append(lines, issue.String())
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ParseProjectConfig reads and validates the config for the project at
+// projectPath, merging all the config layers together.
+// If the config is invalid, it returns an [InvalidConfigError].
+func (svc *Service) ParseProjectConfig(projectPath string) (*Config, error) {
+	cfg, issues, err := svc.ValidateProjectConfig(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, issue := range issues {
+		if !issue.Warning {
+			return nil, &InvalidConfigError{issues}
+		}
+	}
+
+	return cfg, nil
+}
+
+// configExtensions are the extensions of the supported config file formats.
+var configExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// findConfigFile finds the config file in dir called name, which may have any
+// of the supported extensions.
+// It returns an empty string if there is no such file, and an error if there
+// is more than one.
+func findConfigFile(dir, name string) (string, error) {
+	found := []string{}
+
+	for _, ext := range configExtensions {
+		configPath := filepath.Join(dir, name+ext)
+		if _, err := os.Stat(configPath); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return "", err
+		}
+
+		found = append(found, configPath)
+	}
+
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("found more than one config file, there should only be one of %s", strings.Join(found, ", "))
+	}
+}
+
+// FindProjectConfig finds the config file for the project at projectPath,
+// which may be in any of the supported formats.
+// It returns an error if there is more than one config file.
+func (svc *Service) FindProjectConfig(projectPath string) (string, error) {
+	dir := svc.ProjectDataFilePath(projectPath, "")
+
+	configPath, err := findConfigFile(dir, "config")
+	if err != nil {
+		return "", err
+	}
+
+	if configPath == "" {
+		return "", fmt.Errorf("no config file found in %s: %w", dir, fs.ErrNotExist)
+	}
+
+	return configPath, nil
+}
+
+// parseConfigNode parses the config file at configPath based on its
+// extension.
+func parseConfigNode(configPath string, data []byte) (*node, error) {
+	switch filepath.Ext(configPath) {
+	case ".yaml", ".yml":
+		return parseYAMLNode(data)
+	case ".toml":
+		return parseTOMLNode(data)
+	default:
+		return parseJSONNode(data)
+	}
+}
+
+// ValidateProjectConfig reads the config for the project at projectPath,
+// and returns any issues found in it.
+// The config is only returned if there are no issues other than warnings.
+// An error is only returned if a config file could not be read.
+func (svc *Service) ValidateProjectConfig(projectPath string) (*Config, []ConfigIssue, error) {
+	cfg, _, issues, err := svc.resolveProjectConfig(projectPath)
+	return cfg, issues, err
+}
+
+// ConfigValue is a value in the resolved project config, along with the
+// config file it came from.
+type ConfigValue struct {
+	// Key is the path to the value, with object keys separated by dots.
+	Key    string
+	Value  any
+	Source string
+}
+
+// ResolveProjectConfig reads the config for the project at projectPath like
+// [Service.ParseProjectConfig], and also returns every value in it along with
+// the file that the value came from.
+// Arrays are treated as single values, since they are never merged.
+func (svc *Service) ResolveProjectConfig(projectPath string) (*Config, []ConfigValue, error) {
+	cfg, root, issues, err := svc.resolveProjectConfig(projectPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg == nil {
+		return nil, nil, &InvalidConfigError{issues}
+	}
+
+	values := []ConfigValue{}
+
+	var walk func(prefix string, n *node)
+	walk = func(prefix string, n *node) {
+		if n.kind != nodeObject {
+			values = append(values, ConfigValue{prefix, n.toInterface(), n.file})
+			return
+		}
+
+		for _, field := range n.fields {
+			key := field.key
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+
+			walk(key, field.value)
+		}
+	}
+
+	walk("", root)
+
+	return cfg, values, nil
+}
+
+// builtinConfigSource is the source of the values in the built-in defaults.
+const builtinConfigSource = "built-in"
+
+// builtinConfig is the config that every project starts from.
+//
+//go:embed defaults.json
+var builtinConfig []byte
+
+// resolveProjectConfig reads each layer of the config for the project at
+// projectPath, and merges them together.
+// The layers from lowest to highest precedence are:
+//   - The built-in defaults
+//   - The user's config in the config directory, called project.json
+//   - The file included by the project config with the include field
+//   - The project config, called config.json
+//   - The local project config, called config.local.json
+//
+// Any of the files can be in any of the supported formats, and only the
+// project config is required.
+func (svc *Service) resolveProjectConfig(projectPath string) (*Config, *node, []ConfigIssue, error) {
+	v := configValidator{}
+
+	root, err := svc.mergeProjectConfig(projectPath, &v)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if root == nil {
+		return nil, nil, v.issues, nil
+	}
+
+	root = coerceNode(root, reflect.TypeOf(Config{}))
+
+	var cfg Config
+	if err := root.decode(&cfg); err != nil {
+		return nil, nil, nil, err
+	}
+
+	v.checkConfig(root, &cfg)
+
+	for _, issue := range v.issues {
+		if !issue.Warning {
+			return nil, nil, v.issues, nil
+		}
+	}
+
+	return &cfg, root, v.issues, nil
+}
+
+// mergeProjectConfig reads the layers of the config for the project at
+// projectPath and merges them together, without validating the result.
+// If a layer can't be parsed, the issues are added to v and the returned node
+// is nil.
+func (svc *Service) mergeProjectConfig(projectPath string, v *configValidator) (*node, error) {
+	configPath, err := svc.FindProjectConfig(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, err := parseJSONNode(builtinConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid built-in config: %w", err)
+	}
+
+	defaults.setFile(builtinConfigSource)
+	layers := []*node{defaults}
+
+	if svc.configDir != "" {
+		userPath, err := findConfigFile(svc.configDir, "project")
+		if err != nil {
+			return nil, err
+		}
+
+		if userPath != "" {
+			user, err := v.parseLayer(userPath)
+			if err != nil {
+				return nil, err
+			}
+
+			layers = append(layers, user)
+		}
+	}
+
+	project, err := v.parseLayer(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if include := project.at("include"); include != nil && include != project && include.kind == nodeString {
+		includePath, err := expandIncludePath(filepath.Dir(configPath), include.value.(string))
+		if err != nil {
+			return nil, err
+		}
+
+		team, err := v.parseLayer(includePath)
+		if err != nil {
+			v.errorf(include, "unable to read include: %s", err)
+		}
+
+		layers = append(layers, team)
+	}
+
+	layers = append(layers, project)
+
+	localPath, err := findConfigFile(filepath.Dir(configPath), "config.local")
+	if err != nil {
+		return nil, err
+	}
+
+	if localPath != "" {
+		local, err := v.parseLayer(localPath)
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(layers, local)
+	}
+
+	if len(v.issues) > 0 {
+		return nil, nil
+	}
+
+	for _, layer := range layers {
+		if include := layer.at("include"); layer != project && include != layer {
+			v.warnf(include, "include only has an effect in the project config")
+		}
+	}
+
+	root := layers[0]
+	for _, layer := range layers[1:] {
+		root = mergeNodes(root, layer)
+	}
+
+	return root, nil
+}
+
+// expandIncludePath resolves an include path relative to dir, expanding a
+// leading ~ to the user's home directory.
+func expandIncludePath(dir, includePath string) (string, error) {
+	if rel, ok := strings.CutPrefix(includePath, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(home, rel), nil
+	}
+
+	if filepath.IsAbs(includePath) {
+		return includePath, nil
+	}
+
+	return filepath.Join(dir, includePath), nil
+}
+
+// mergeNodes merges the override node on top of the base node.
+// Objects are merged field by field, with fields in override taking
+// precedence.
+// Everything else, including arrays, is replaced by the value in override.
+// A null value in override removes the field from the result.
+func mergeNodes(base, override *node) *node {
+	if base.kind != nodeObject || override.kind != nodeObject {
+		return override
+	}
+
+	merged := *override
+	merged.fields = []nodeField{}
+
+	for _, field := range base.fields {
+		if value := override.at(field.key); value != override {
+			field.value = mergeNodes(field.value, value)
+		}
+
+		if field.value.kind != nodeNull {
+			merged.fields = append(merged.fields, field)
+		}
+	}
+
+	for _, field := range override.fields {
+		if base.at(field.key) == base && field.value.kind != nodeNull {
+			merged.fields = append(merged.fields, field)
+		}
+	}
+
+	return &merged
+}
+
+// ConvertProjectConfig rewrites the config file for the project at
+// projectPath in another format, which is one of "json", "yaml" or "toml".
+// The old config file is removed, and the path to the new one is returned.
+// Comments in the old config file are not preserved.
+// Only the project config file is converted, the other config layers are not
+// included.
+func (svc *Service) ConvertProjectConfig(projectPath, format string) (string, error) {
+	oldPath, err := svc.FindProjectConfig(projectPath)
+	if err != nil {
+		return "", err
+	}
+
+	newPath := svc.ProjectDataFilePath(projectPath, "config."+format)
+	if oldPath == newPath || (format == "yaml" && filepath.Ext(oldPath) == ".yml") {
+		return "", fmt.Errorf("config is already in %s format", format)
+	}
+
+	v := configValidator{}
+
+	root, err := v.parseLayer(oldPath)
+	if err != nil {
+		return "", err
+	}
+
+	if len(v.issues) > 0 {
+		return "", &InvalidConfigError{v.issues}
+	}
+
+	var data []byte
+
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(root, "", "    ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = root.marshalYAML()
+	case "toml":
+		data, err = root.marshalTOML()
+	default:
+		return "", fmt.Errorf("unsupported config format %q", format)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(oldPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(newPath, data, info.Mode()); err != nil {
+		return "", err
+	}
+
+	if err := os.Remove(oldPath); err != nil {
+		return "", err
+	}
+
+	return newPath, nil
+}
+
+type configValidator struct {
+	issues []ConfigIssue
+}
+
+// parseLayer reads and parses a single config file, and checks that it has
+// the right structure.
+// If the file has any issues, they are recorded and an empty object is
+// returned in its place.
+// An error is only returned if the file could not be read.
+func (v *configValidator) parseLayer(configPath string) (*node, error) {
+	empty := &node{kind: nodeObject, file: configPath}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return empty, err
+	}
+
+	root, err := parseConfigNode(configPath, data)
+	if err != nil {
+		v.syntaxError(configPath, err)
+		return empty, nil
+	}
+
+	root.setFile(configPath)
+
+	issues := len(v.issues)
+	v.checkType(root, reflect.TypeOf(Config{}))
+	if len(v.issues) > issues {
+		return empty, nil
+	}
+
+	return root, nil
+}
+
+func (v *configValidator) report(n *node, warning bool, format string, args ...any) {
+	issue := ConfigIssue{
+		Message: fmt.Sprintf(format, args...),
+		Warning: warning,
+	}
+
+	if n != nil {
+		issue.File = n.file
+		issue.Line = n.line
+		issue.Column = n.column
+	}
+
+	v.issues = append(v.issues, issue)
+}
+
+func (v *configValidator) errorf(n *node, format string, args ...any) {
+	v.report(n, false, format, args...)
+}
+
+func (v *configValidator) warnf(n *node, format string, args ...any) {
+	v.report(n, true, format, args...)
+}
+
+func (v *configValidator) syntaxError(configPath string, err error) {
+	n := &node{file: configPath}
+
+	var syntaxErr *syntaxError
+	if errors.As(err, &syntaxErr) {
+		n.line, n.column = syntaxErr.line, syntaxErr.column
+		err = syntaxErr.err
+	}
+
+	v.errorf(n, "%s", err)
+}
+
+// checkType checks that the node can be decoded into a value of type t,
+// without any unknown fields.
+func (v *configValidator) checkType(n *node, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if n.kind == nodeNull {
+		return
+	}
+
+	// A command can be written as just its script
+	if t == reflect.TypeOf(Command{}) && n.kind == nodeString {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.kind != nodeObject {
+			v.errorf(n, "expected an object but got %s", n.kind)
+			return
+		}
+
+		fields := jsonFields(t)
+		names := []string{}
+		for name := range fields {
+			names = append(names, name)
+		}
+
+		for _, field := range n.fields {
+			ft, ok := fields[field.key]
+			if !ok {
+				if suggestion := closestName(field.key, names); suggestion != "" {
+					v.errorf(field.keyNode, "unknown field %q, did you mean %q?", field.key, suggestion)
+				} else {
+					v.errorf(field.keyNode, "unknown field %q", field.key)
+				}
+
+				continue
+			}
+
+			v.checkType(field.value, ft)
+		}
+	case reflect.Map:
+		if n.kind != nodeObject {
+			v.errorf(n, "expected an object but got %s", n.kind)
+			return
+		}
+
+		for _, field := range n.fields {
+			v.checkType(field.value, t.Elem())
+		}
+	case reflect.Slice:
+		if n.kind != nodeArray {
+			v.errorf(n, "expected an array but got %s", n.kind)
+			return
+		}
+
+		for _, item := range n.items {
+			v.checkType(item, t.Elem())
+		}
+	case reflect.String:
+		// Numbers are accepted as strings, since YAML and TOML make it
+		// awkward to quote values like sizes or ports, and they are
+		// converted by coerceNode
+		if n.kind != nodeString && n.kind != nodeNumber {
+			v.errorf(n, "expected a string but got %s", n.kind)
+		}
+	case reflect.Bool:
+		if n.kind != nodeBool {
+			v.errorf(n, "expected a boolean but got %s", n.kind)
+		}
+	}
+}
+
+// coerceNode returns a copy of a node that has been checked with checkType,
+// with the numbers that t expects to be strings turned into strings, so that
+// it can be decoded into t.
+// The node itself is not changed.
+func coerceNode(n *node, t reflect.Type) *node {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	coerced := *n
+
+	switch {
+	case t == reflect.TypeOf(Command{}) && n.kind == nodeString:
+		// A command written as just its script is decoded by
+		// Command.UnmarshalJSON
+	case t.Kind() == reflect.Struct && n.kind == nodeObject:
+		fields := jsonFields(t)
+
+		coerced.fields = make([]nodeField, len(n.fields))
+		for i, field := range n.fields {
+			if ft, ok := fields[field.key]; ok {
+				field.value = coerceNode(field.value, ft)
+			}
+
+			coerced.fields[i] = field
+		}
+	case t.Kind() == reflect.Map && n.kind == nodeObject:
+		coerced.fields = make([]nodeField, len(n.fields))
+		for i, field := range n.fields {
+			field.value = coerceNode(field.value, t.Elem())
+			coerced.fields[i] = field
+		}
+	case t.Kind() == reflect.Slice && n.kind == nodeArray:
+		coerced.items = make([]*node, len(n.items))
+		for i, item := range n.items {
+			coerced.items[i] = coerceNode(item, t.Elem())
+		}
+	case t.Kind() == reflect.String && n.kind == nodeNumber:
+		coerced.kind = nodeString
+		coerced.value = n.value.(json.Number).String()
+	}
+
+	return &coerced
+}
+
+// jsonFields maps the JSON field names of the struct type t to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fields[name] = field.Type
+	}
+
+	return fields
+}
+
+// closestName returns the name that is the fewest edits away from s, as long
+// as it is close enough to be a likely typo.
+func closestName(s string, names []string) string {
+	slices.Sort(names)
+
+	best := ""
+	bestDistance := 3
+
+	for _, name := range names {
+		if d := editDistance(s, name); d < bestDistance {
+			best = name
+			bestDistance = d
+		}
+	}
+
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+var sizePattern = regexp.MustCompile(`^[0-9]+%?$`)
+
+// checkConfig checks the values in a config that has already been decoded.
+func (v *configValidator) checkConfig(root *node, cfg *Config) {
+	for _, name := range sortedKeys(cfg.Commands) {
+		command := cfg.Commands[name]
+		commandNode := root.at("commands", name)
+
+		if command.Run == "" && len(command.Deps) == 0 {
+			v.errorf(commandNode, "command %q has nothing to run", name)
+		}
+
+		for ei, env := range command.Env {
+			if !strings.Contains(env, "=") {
+				v.errorf(commandNode.at("env", ei), "environment variable %q should be in the form KEY=VALUE", env)
+			}
+		}
+
+		if command.Cwd != "" && !filepath.IsLocal(command.Cwd) {
+			v.warnf(commandNode.at("cwd"), "cwd %q is outside the project, the project directory will be used instead", command.Cwd)
+		}
+
+		for di, dep := range command.Deps {
+			if _, ok := cfg.Commands[dep]; !ok {
+				v.errorf(commandNode.at("deps", di), "dependency %q is not a command", dep)
+			}
+		}
+
+		if cycle := commandCycle(cfg.Commands, name); cycle != nil {
+			v.errorf(commandNode.at("deps"), "command %q depends on itself through %s", name, strings.Join(cycle, " -> "))
+		}
+
+		for wi, glob := range command.Watch {
+			if err := checkGlob(glob); err != nil {
+				v.errorf(commandNode.at("watch", wi), "watch glob %q is invalid: %s", glob, err)
+			}
+		}
+	}
+
+	v.checkWindows(root.at("windows"), cfg.Windows)
+
+	for _, name := range sortedKeys(cfg.Layouts) {
+		layoutNode := root.at("layouts", name)
+
+		if strings.ContainsAny(name, ".:") {
+			v.errorf(layoutNode, "layout name %q cannot contain '.' or ':'", name)
+		}
+
+		// Switching to a layout replaces the windows of the session, which
+		// would be left with none
+		if len(cfg.Layouts[name]) == 0 {
+			v.errorf(layoutNode, "layout %q has no windows", name)
+		}
+
+		v.checkWindows(layoutNode, cfg.Layouts[name])
+	}
+
+	if cfg.DefaultLayout != "" {
+		if _, ok := cfg.Layouts[cfg.DefaultLayout]; !ok {
+			v.errorf(root.at("default_layout"), "default layout %q is not one of the layouts", cfg.DefaultLayout)
+		}
+	}
+}
+
+// checkWindows checks a list of windows, where windowsNode is the array that
+// they were decoded from.
+func (v *configValidator) checkWindows(windowsNode *node, windows []Window) {
+	for wi, window := range windows {
+		windowNode := windowsNode.at(wi)
+
+		if window.Layout != "" {
+			if err := checkLayout(window.Layout); err != nil {
+				v.errorf(windowNode.at("layout"), "invalid layout %q: %s", window.Layout, err)
+			}
+		}
+
+		for pi, pane := range window.Panes {
+			paneNode := windowNode.at("panes", pi)
+
+			if pane.Pwd != "" && !filepath.IsLocal(pane.Pwd) {
+				v.warnf(paneNode.at("pwd"), "pwd %q is outside the project, the project directory will be used instead", pane.Pwd)
+			}
+
+			for ei, env := range pane.Env {
+				if !strings.Contains(env, "=") {
+					v.errorf(paneNode.at("env", ei), "environment variable %q should be in the form KEY=VALUE", env)
+				}
+			}
+
+			switch pane.Split {
+			case "", SplitHorizontal, SplitVertical:
+			default:
+				v.errorf(paneNode.at("split"), "invalid split %q, expected %q or %q", pane.Split, SplitHorizontal, SplitVertical)
+			}
+
+			if pane.Size != "" && !sizePattern.MatchString(pane.Size) {
+				v.errorf(paneNode.at("size"), "invalid size %q, expected a number of cells or a percentage", pane.Size)
+			}
+
+			switch pane.Role {
+			case "", RoleEditor:
+			default:
+				v.errorf(paneNode.at("role"), "invalid role %q, expected %q", pane.Role, RoleEditor)
+			}
+
+			if pane.Target != "" {
+				found := slices.ContainsFunc(window.Panes[:pi], func(p Pane) bool {
+					return p.Name == pane.Target
+				})
+
+				if !found {
+					v.errorf(paneNode.at("target"), "target %q is not the name of an earlier pane in the window", pane.Target)
+				}
+			}
+
+			if pane.WaitFor != nil {
+				waitNode := paneNode.at("wait_for")
+
+				if pane.WaitFor.File == "" && pane.WaitFor.TCP == "" {
+					v.errorf(waitNode, "wait_for needs a file or tcp address")
+				}
+
+				if pane.WaitFor.TCP != "" {
+					if _, _, err := net.SplitHostPort(pane.WaitFor.Address()); err != nil {
+						v.errorf(waitNode.at("tcp"), "invalid tcp address %q", pane.WaitFor.TCP)
+					}
+				}
+
+				if len(pane.SendKeys) == 0 {
+					v.warnf(waitNode, "wait_for has no effect without send_keys")
+				}
+			}
+		}
+	}
+}
+
+var layoutPresets = []string{
+	"even-horizontal",
+	"even-vertical",
+	"main-horizontal",
+	"main-horizontal-mirrored",
+	"main-vertical",
+	"main-vertical-mirrored",
+	"tiled",
+}
+
+// checkLayout checks that layout is either one of the preset layouts, or a
+// layout string as printed by list-windows, including its checksum.
+func checkLayout(layout string) error {
+	if slices.Contains(layoutPresets, layout) {
+		return nil
+	}
+
+	checksum, cells, ok := strings.Cut(layout, ",")
+	if !ok || len(checksum) != 4 {
+		return fmt.Errorf("expected one of %s or a layout string", strings.Join(layoutPresets, ", "))
+	}
+
+	expected, err := strconv.ParseUint(checksum, 16, 16)
+	if err != nil {
+		return fmt.Errorf("bad checksum %q", checksum)
+	}
+
+	p := layoutParser{s: cells}
+	if err := p.cell(); err != nil {
+		return err
+	}
+
+	if p.pos != len(p.s) {
+		return fmt.Errorf("unexpected %q at offset %d", p.s[p.pos:], len(checksum)+1+p.pos)
+	}
+
+	if actual := layoutChecksum(cells); uint16(expected) != actual {
+		return fmt.Errorf("checksum is %s but should be %04x", checksum, actual)
+	}
+
+	return nil
+}
+
+// layoutChecksum is the checksum Tmux uses to check layout strings.
+func layoutChecksum(layout string) uint16 {
+	var checksum uint16
+
+	for i := 0; i < len(layout); i++ {
+		checksum = (checksum >> 1) + ((checksum & 1) << 15)
+		checksum += uint16(layout[i])
+	}
+
+	return checksum
+}
+
+// layoutParser parses the cells of a layout string, which look like
+// WIDTHxHEIGHT,X,Y followed by either a pane ID or a list of child cells in
+// {} for cells side by side or [] for cells on top of each other.
+type layoutParser struct {
+	s   string
+	pos int
+}
+
+func (p *layoutParser) number() error {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+
+	if start == p.pos {
+		return fmt.Errorf("expected a number at offset %d", p.pos)
+	}
+
+	return nil
+}
+
+func (p *layoutParser) expect(c byte) error {
+	if p.pos >= len(p.s) || p.s[p.pos] != c {
+		return fmt.Errorf("expected %q at offset %d", c, p.pos)
+	}
+
+	p.pos++
+
+	return nil
+}
+
+func (p *layoutParser) peek() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+
+	return p.s[p.pos]
+}
+
+func (p *layoutParser) cell() error {
+	for _, step := range []func() error{
+		p.number,
+		func() error { return p.expect('x') },
+		p.number,
+		func() error { return p.expect(',') },
+		p.number,
+		func() error { return p.expect(',') },
+		p.number,
+	} {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+
+	switch p.peek() {
+	case ',':
+		p.pos++
+		return p.number()
+	case '{', '[':
+		end := byte('}')
+		if p.peek() == '[' {
+			end = ']'
+		}
+
+		p.pos++
+
+		for {
+			if err := p.cell(); err != nil {
+				return err
+			}
+
+			if p.peek() != ',' {
+				break
+			}
+
+			p.pos++
+		}
+
+		return p.expect(end)
+	default:
+		return nil
+	}
+}
+
+type Config struct {
+	// Include is the path to another config file, which is merged underneath
+	// this one.
+	// It is resolved relative to the directory containing this config file.
+	Include  string             `json:"include,omitempty"`
+	Commands map[string]Command `json:"commands,omitempty"`
+	Session  *Session           `json:"session,omitempty"`
+	Windows  []Window           `json:"windows,omitempty"`
+	// Layouts are named alternatives to Windows, which each get their own
+	// session.
+	Layouts map[string][]Window `json:"layouts,omitempty"`
+	// DefaultLayout is the name of the layout to use instead of Windows when
+	// no layout is chosen.
+	DefaultLayout string `json:"default_layout,omitempty"`
+	// BranchFileMarks keeps separate file marks for each Git branch.
+	BranchFileMarks bool `json:"branch_file_marks,omitempty"`
+}
+
+// Layout returns the windows for the layout with the given name.
+// If name is empty, the default layout is used, or Windows if there is none.
+func (cfg *Config) Layout(name string) ([]Window, error) {
+	if name == "" {
+		name = cfg.DefaultLayout
+	}
+
+	if name == "" {
+		return cfg.Windows, nil
+	}
+
+	windows, ok := cfg.Layouts[name]
+	if !ok {
+		return nil, fmt.Errorf("no such layout %q", name)
+	}
+
+	return windows, nil
+}
+
+// Command is a script that can be run with torpedo run.
+// In the config, a command can either be an object or just the script as a
+// string.
+type Command struct {
+	// Run is the script, which is passed to the shell with -c.
+	Run string `json:"run,omitempty"`
+	// Description is shown when listing the commands.
+	Description string `json:"description,omitempty"`
+	// Env is a list of KEY=VALUE pairs added to the environment of the
+	// script.
+	Env []string `json:"env,omitempty"`
+	// Cwd is the directory to run the script in, relative to the project.
+	Cwd string `json:"cwd,omitempty"`
+	// Shell overrides the user's shell for running the script.
+	Shell string `json:"shell,omitempty"`
+	// Deps are the names of commands to run before this one.
+	Deps []string `json:"deps,omitempty"`
+	// Parallel runs the Deps at the same time, instead of one after another.
+	Parallel bool `json:"parallel,omitempty"`
+	// Watch limits the files that run the command again in watch mode to
+	// the ones that match one of these globs.
+	Watch []string `json:"watch,omitempty"`
+}
+
+func (c *Command) UnmarshalJSON(data []byte) error {
+	var script string
+	if err := json.Unmarshal(data, &script); err == nil {
+		*c = Command{Run: script}
+		return nil
+	}
+
+	// Use a different type so this method isn't called again
+	type command Command
+	return json.Unmarshal(data, (*command)(c))
+}
+
+func (c Command) MarshalJSON() ([]byte, error) {
+	// Commands that are only a script are written the short way
+	if c.Description == "" && len(c.Env) == 0 && c.Cwd == "" && c.Shell == "" && len(c.Deps) == 0 && !c.Parallel && len(c.Watch) == 0 {
+		return json.Marshal(c.Run)
+	}
+
+	type command Command
+	return json.Marshal(command(c))
+}
+
+// Dir returns the directory that the command runs in.
+// Like [Pane.StartDirectory], it is the project directory if Cwd is not a
+// subdirectory of the project.
+func (c *Command) Dir(projectDir string) string {
+	if filepath.IsLocal(c.Cwd) {
+		return filepath.Join(projectDir, c.Cwd)
+	}
+
+	return projectDir
+}
+
+// Session holds settings that apply to the whole Tmux session, rather than
+// individual windows or panes.
+type Session struct {
+	// Options are set with set-option.
+	Options map[string]string `json:"options,omitempty"`
+	// Environment is set with set-environment, so all new panes in the
+	// session inherit it.
+	Environment map[string]string `json:"environment,omitempty"`
+	// Hooks are set with set-hook, and map hook names to Tmux commands.
+	Hooks map[string]string `json:"hooks,omitempty"`
+}
+
+const (
+	SplitHorizontal = "horizontal"
+	SplitVertical   = "vertical"
+)
+
+// RoleEditor marks the pane that file marks are opened in.
+const RoleEditor = "editor"
+
+type Pane struct {
+	Name   string   `json:"name,omitempty"`
+	Pwd    string   `json:"pwd,omitempty"`
+	Env    []string `json:"env,omitempty"`
+	Cmd    []string `json:"cmd,omitempty"`
+	Active bool     `json:"active,omitempty"`
+	// Split is the direction to split the target pane in to create this one,
+	// either [SplitHorizontal] or [SplitVertical].
+	Split string `json:"split,omitempty"`
+	// Size is the size of the pane as a number of lines/columns or a
+	// percentage.
+	Size string `json:"size,omitempty"`
+	// Target is the name of an earlier pane in the same window to split.
+	// If it is empty, the previous pane is split.
+	Target string `json:"target,omitempty"`
+	Zoom   bool   `json:"zoom,omitempty"`
+	Title  string `json:"title,omitempty"`
+	// SendKeys are lines typed into the pane after it starts.
+	SendKeys []string `json:"send_keys,omitempty"`
+	// WaitFor delays SendKeys until the condition is met.
+	WaitFor *WaitFor `json:"wait_for,omitempty"`
+	// Role tells torpedo what the pane is used for, such as [RoleEditor].
+	Role string `json:"role,omitempty"`
+}
+
+type WaitFor struct {
+	// File is a path relative to the project that must exist.
+	File string `json:"file,omitempty"`
+	// TCP is an address that must accept TCP connections.
+	// If it is just a port, the host defaults to localhost.
+	TCP string `json:"tcp,omitempty"`
+}
+
+func (w *WaitFor) Path(projectDir string) string {
+	if filepath.IsAbs(w.File) {
+		return w.File
+	}
+
+	return filepath.Join(projectDir, w.File)
+}
+
+func (w *WaitFor) Address() string {
+	if _, err := strconv.Atoi(w.TCP); err == nil {
+		return net.JoinHostPort("localhost", w.TCP)
+	}
+
+	return w.TCP
+}
+
+func (p *Pane) StartDirectory(projectDir string) string {
+	if filepath.IsLocal(p.Pwd) {
+		return filepath.Join(projectDir, p.Pwd)
+	}
+
+	return projectDir
+}
+
+type Window struct {
+	Name   string `json:"name,omitempty"`
+	Layout string `json:"layout,omitempty"`
+	Panes  []Pane `json:"panes,omitempty"`
+	Active bool   `json:"active,omitempty"`
+}
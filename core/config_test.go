@@ -0,0 +1,330 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLayout(t *testing.T) {
+	valid := []string{
+		"tiled",
+		"main-vertical",
+		"c4dd,210x56,0,0,0",
+		"9295,80x24,0,0[80x11,0,0,0,80x12,0,12,1]",
+	}
+
+	for _, layout := range valid {
+		require.NoError(t, checkLayout(layout), layout)
+	}
+
+	invalid := []string{
+		"tilde",
+		"c4de,210x56,0,0,0",
+		"9295,80x24,0,0[80x11,0,0,0,80x12,0,12,1",
+		"c4dd,210x56,0,0,0,",
+	}
+
+	for _, layout := range invalid {
+		require.Error(t, checkLayout(layout), layout)
+	}
+}
+
+func TestValidateProjectConfig(t *testing.T) {
+	tests := []struct {
+		Name     string
+		File     string
+		Config   string
+		Expected []ConfigIssue
+	}{
+		{
+			Name:   "valid",
+			Config: `{"windows": [{"name": "editor", "layout": "tiled"}]}`,
+		},
+		{
+			Name:   "syntax error",
+			Config: "{\n  \"windows\": [}\n",
+			Expected: []ConfigIssue{
+				{Line: 2, Column: 15, Message: "invalid character '}' looking for beginning of value"},
+			},
+		},
+		{
+			Name:   "unknown field",
+			Config: "{\n  \"windows\": [\n    {\"panse\": []}\n  ]\n}\n",
+			Expected: []ConfigIssue{
+				{Line: 3, Column: 6, Message: `unknown field "panse", did you mean "panes"?`},
+			},
+		},
+		{
+			Name:   "wrong type",
+			Config: `{"windows": [{"active": "yes"}]}`,
+			Expected: []ConfigIssue{
+				{Line: 1, Column: 25, Message: "expected a boolean but got a string"},
+			},
+		},
+		{
+			Name:   "invalid values",
+			Config: "{\"windows\": [{\n\"layout\": \"tilde\",\n\"panes\": [{\"pwd\": \"../foo\"}, {\"split\": \"diagonal\", \"target\": \"missing\"}]\n}]}",
+			Expected: []ConfigIssue{
+				{Line: 2, Column: 11, Message: `invalid layout "tilde": expected one of even-horizontal, even-vertical, main-horizontal, main-horizontal-mirrored, main-vertical, main-vertical-mirrored, tiled or a layout string`},
+				{Line: 3, Column: 19, Message: `pwd "../foo" is outside the project, the project directory will be used instead`, Warning: true},
+				{Line: 3, Column: 40, Message: `invalid split "diagonal", expected "horizontal" or "vertical"`},
+				{Line: 3, Column: 62, Message: `target "missing" is not the name of an earlier pane in the window`},
+			},
+		},
+		{
+			Name:   "layouts",
+			Config: "{\"default_layout\": \"dev\",\n\"layouts\": {\"debug\": [{\"layout\": \"tilde\"}], \"a.b\": []}}",
+			Expected: []ConfigIssue{
+				{Line: 2, Column: 52, Message: `layout name "a.b" cannot contain '.' or ':'`},
+				{Line: 2, Column: 52, Message: `layout "a.b" has no windows`},
+				{Line: 2, Column: 34, Message: `invalid layout "tilde": expected one of even-horizontal, even-vertical, main-horizontal, main-horizontal-mirrored, main-vertical, main-vertical-mirrored, tiled or a layout string`},
+				{Line: 1, Column: 20, Message: `default layout "dev" is not one of the layouts`},
+			},
+		},
+		{
+			Name:   "commands",
+			Config: "{\"commands\": {\"test\": \"go test\", \"build\": {\"run\": \"make\", \"cwd\": \"/tmp\"}, \"lint\": {\"shell\": \"bash\"}}}",
+			Expected: []ConfigIssue{
+				{Line: 1, Column: 66, Message: `cwd "/tmp" is outside the project, the project directory will be used instead`, Warning: true},
+				{Line: 1, Column: 83, Message: `command "lint" has nothing to run`},
+			},
+		},
+		{
+			Name:   "command deps",
+			File:   "config.yaml",
+			Config: "commands:\n  a:\n    deps: [b, missing]\n  b:\n    deps: [a]\n    env: [FOO]\n",
+			Expected: []ConfigIssue{
+				{Line: 3, Column: 15, Message: `dependency "missing" is not a command`},
+				{Line: 3, Column: 11, Message: `command "a" depends on itself through a -> b -> a`},
+				{Line: 6, Column: 11, Message: `environment variable "FOO" should be in the form KEY=VALUE`},
+				{Line: 5, Column: 11, Message: `command "b" depends on itself through b -> a -> b`},
+			},
+		},
+		{
+			Name:   "pane role",
+			File:   "config.yaml",
+			Config: "windows:\n  - panes:\n      - role: editr\n",
+			Expected: []ConfigIssue{
+				{Line: 3, Column: 15, Message: `invalid role "editr", expected "editor"`},
+			},
+		},
+		{
+			Name:   "command watch",
+			File:   "config.yaml",
+			Config: "commands:\n  test:\n    run: go test ./...\n    watch: ['**/*.go', '[']\n",
+			Expected: []ConfigIssue{
+				{Line: 4, Column: 24, Message: `watch glob "[" is invalid: syntax error in pattern`},
+			},
+		},
+		{
+			Name:   "yaml",
+			File:   "config.yaml",
+			Config: "windows:\n  - name: editor\n    panse: []\n    panes:\n      - size: 30\n",
+			Expected: []ConfigIssue{
+				{Line: 3, Column: 5, Message: `unknown field "panse", did you mean "panes"?`},
+			},
+		},
+		{
+			Name:   "yaml syntax error",
+			File:   "config.yml",
+			Config: "windows:\n  - name: editor\n    layout: tiled: foo\n",
+			Expected: []ConfigIssue{
+				{Line: 3, Message: "mapping values are not allowed in this context"},
+			},
+		},
+		{
+			Name:   "toml",
+			File:   "config.toml",
+			Config: "[[windows]]\nname = \"editor\"\nlayout = \"tilde\"\n\n[[windows.panes]]\nsize = 30\n",
+			Expected: []ConfigIssue{
+				{Line: 3, Column: 10, Message: `invalid layout "tilde": expected one of even-horizontal, even-vertical, main-horizontal, main-horizontal-mirrored, main-vertical, main-vertical-mirrored, tiled or a layout string`},
+			},
+		},
+		{
+			Name:   "toml duplicate key",
+			File:   "config.toml",
+			Config: "[commands]\ntest = \"go test\"\ntest = \"make test\"\n",
+			Expected: []ConfigIssue{
+				{Line: 3, Column: 1, Message: `key "test" is already defined`},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			if test.File == "" {
+				test.File = "config.json"
+			}
+
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, projectDataDir, test.File)
+			require.NoError(t, os.Mkdir(filepath.Dir(configPath), 0777))
+			require.NoError(t, os.WriteFile(configPath, []byte(test.Config), 0666))
+
+			for i := range test.Expected {
+				test.Expected[i].File = configPath
+			}
+
+			svc := New("")
+			_, issues, err := svc.ValidateProjectConfig(dir)
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, issues)
+		})
+	}
+}
+
+func TestFindProjectConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, projectDataDir), 0777))
+
+	svc := New("")
+
+	_, err := svc.FindProjectConfig(dir)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	for _, name := range []string{"config.json", "config.toml"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, projectDataDir, name), []byte("{}"), 0666))
+	}
+
+	_, err = svc.FindProjectConfig(dir)
+	require.Error(t, err)
+}
+
+func TestConfigLayout(t *testing.T) {
+	editor := []Window{{Name: "editor"}}
+	debug := []Window{{Name: "debugger"}}
+
+	cfg := Config{Windows: editor, Layouts: map[string][]Window{"debug": debug}}
+
+	windows, err := cfg.Layout("")
+	require.NoError(t, err)
+	require.Equal(t, editor, windows)
+
+	windows, err = cfg.Layout("debug")
+	require.NoError(t, err)
+	require.Equal(t, debug, windows)
+
+	_, err = cfg.Layout("missing")
+	require.Error(t, err)
+
+	cfg.DefaultLayout = "debug"
+
+	windows, err = cfg.Layout("")
+	require.NoError(t, err)
+	require.Equal(t, debug, windows)
+}
+
+func TestCommandUnmarshalJSON(t *testing.T) {
+	var commands map[string]Command
+	err := json.Unmarshal([]byte(`{"test": "go test", "build": {"run": "make", "cwd": "src", "shell": "bash"}}`), &commands)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]Command{
+		"test":  {Run: "go test"},
+		"build": {Run: "make", Cwd: "src", Shell: "bash"},
+	}, commands)
+
+	data, err := json.Marshal(commands)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"test": "go test", "build": {"run": "make", "cwd": "src", "shell": "bash"}}`, string(data))
+}
+
+func TestConvertProjectConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, projectDataDir), 0777))
+
+	config := `{"commands": {"test": "go test"}, "windows": [{"name": "editor", "panes": [{"cmd": ["nvim"]}, {"size": "25%"}]}]}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, projectDataDir, "config.json"), []byte(config), 0666))
+
+	svc := New("")
+
+	expected, err := svc.ParseProjectConfig(dir)
+	require.NoError(t, err)
+
+	for _, format := range []string{"yaml", "toml", "json"} {
+		path, err := svc.ConvertProjectConfig(dir, format)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(dir, projectDataDir, "config."+format), path)
+
+		actual, err := svc.ParseProjectConfig(dir)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+
+	_, err = svc.ConvertProjectConfig(dir, "json")
+	require.Error(t, err)
+}
+
+func TestResolveProjectConfig(t *testing.T) {
+	dir := t.TempDir()
+	configDir := t.TempDir()
+	dataDir := filepath.Join(dir, projectDataDir)
+	require.NoError(t, os.Mkdir(dataDir, 0777))
+
+	files := map[string]string{
+		filepath.Join(configDir, "project.yaml"):      "commands:\n  lint: golangci-lint run\n  fmt: gofmt -w .\nwindows:\n  - name: editor\n",
+		filepath.Join(dir, "team.toml"):               "[commands]\nlint = \"make lint\"\n",
+		filepath.Join(dataDir, "config.json"):         `{"include": "../team.toml", "commands": {"test": "go test"}, "windows": [{"name": "shell"}]}`,
+		filepath.Join(dataDir, "config.local.json"):   `{"commands": {"fmt": null}, "session": {"options": {"status-style": "bg=red"}}}`,
+		filepath.Join(dataDir, "unrelated.yaml"):      "not: config",
+		filepath.Join(configDir, "unrelated.json"):    "{}",
+		filepath.Join(configDir, "templates", "x.go"): "",
+	}
+
+	for path, data := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0666))
+	}
+
+	svc := New(configDir)
+
+	cfg, values, err := svc.ResolveProjectConfig(dir)
+	require.NoError(t, err)
+
+	require.Equal(t, &Config{
+		Include: "../team.toml",
+		Commands: map[string]Command{
+			"lint": {Run: "make lint"},
+			"test": {Run: "go test"},
+		},
+		Session: &Session{
+			Options: map[string]string{"status-style": "bg=red"},
+		},
+		Windows: []Window{{Name: "shell"}},
+	}, cfg)
+
+	require.Equal(t, []ConfigValue{
+		{"branch_file_marks", false, "built-in"},
+		{"commands.lint", "make lint", filepath.Join(dir, "team.toml")},
+		{"commands.test", "go test", filepath.Join(dataDir, "config.json")},
+		{"windows", []any{map[string]any{"name": "shell"}}, filepath.Join(dataDir, "config.json")},
+		{"include", "../team.toml", filepath.Join(dataDir, "config.json")},
+		{"session.options.status-style", "bg=red", filepath.Join(dataDir, "config.local.json")},
+	}, values)
+}
+
+func TestNumbersAsStrings(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, projectDataDir), 0777))
+
+	configPath := filepath.Join(dir, projectDataDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("windows:\n  - name: 1\n    panes:\n      - size: 30\n"), 0666))
+
+	// Checking a layer doesn't change it, so converting the config keeps
+	// the numbers as they were written
+	v := configValidator{}
+	root, err := v.parseLayer(configPath)
+	require.NoError(t, err)
+	require.Empty(t, v.issues)
+	require.Equal(t, nodeNumber, root.at("windows", 0, "name").kind)
+	require.Equal(t, nodeNumber, root.at("windows", 0, "panes", 0, "size").kind)
+
+	cfg, values, err := New("").ResolveProjectConfig(dir)
+	require.NoError(t, err)
+	require.Equal(t, []Window{{Name: "1", Panes: []Pane{{Size: "30"}}}}, cfg.Windows)
+	require.Contains(t, values, ConfigValue{"windows", []any{map[string]any{"name": "1", "panes": []any{map[string]any{"size": "30"}}}}, configPath})
+}
@@ -0,0 +1,229 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/jamesbehr/torpedo/tmux"
+)
+
+const (
+	// roleOption is the pane option that holds the role of a pane from the
+	// config.
+	roleOption = "@torpedo-role"
+	// nvimServerOption is the pane option that Neovim can set to the address
+	// of its server, so that files are opened through it instead of by typing
+	// into the pane.
+	nvimServerOption = "@torpedo-nvim-server"
+)
+
+// The editors that [Service.OpenInEditor] knows how to open files in.
+const (
+	EditorNeovim  = "nvim"
+	EditorVim     = "vim"
+	EditorHelix   = "helix"
+	EditorKakoune = "kakoune"
+)
+
+// editorCommands maps the commands that are running in panes to editors.
+var editorCommands = map[string]string{
+	"nvim":  EditorNeovim,
+	"vim":   EditorVim,
+	"vi":    EditorVim,
+	"hx":    EditorHelix,
+	"helix": EditorHelix,
+	"kak":   EditorKakoune,
+}
+
+// EditorPane is a pane that a file can be opened in.
+type EditorPane struct {
+	ID       string
+	WindowID string
+	// Editor is the editor running in the pane, or empty if it isn't one that
+	// torpedo knows about.
+	Editor string
+	// Server is the address of the Neovim server, if it is known.
+	Server string
+}
+
+// FindEditorPane finds the pane that files should be opened in, in a session.
+// This is the pane with the editor role if there is one, or else a pane
+// running an editor, preferring the active window and pane.
+func (svc *Service) FindEditorPane(sessionName string) (*EditorPane, error) {
+	listPanes := tmux.ListPanes{
+		Session: true,
+		Target:  "=" + sessionName,
+		// tmux replaces tabs in the output, so fields are separated by spaces,
+		// and the server address is last since it can contain them
+		Format: "#{pane_id} #{window_id} #{window_active} #{pane_active} #{pane_current_command} #{" + roleOption + "} #{" + nvimServerOption + "}",
+	}
+
+	output, err := svc.tmux.Output(&listPanes)
+	if err != nil {
+		return nil, fmt.Errorf("FindEditorPane: %w", err)
+	}
+
+	pane, err := chooseEditorPane(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("FindEditorPane: %w", err)
+	}
+
+	return pane, nil
+}
+
+// chooseEditorPane chooses the editor pane from the output of list-panes.
+func chooseEditorPane(output string) (*EditorPane, error) {
+	var byRole, byCommand *EditorPane
+	roleScore, commandScore := -1, -1
+
+	for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		fields := strings.SplitN(line, " ", 7)
+		if len(fields) != 7 {
+			continue
+		}
+
+		// Distributions install some editors with a suffix, like vim.basic
+		command, _, _ := strings.Cut(fields[4], ".")
+
+		pane := &EditorPane{
+			ID:       fields[0],
+			WindowID: fields[1],
+			Editor:   editorCommands[command],
+			Server:   fields[6],
+		}
+
+		score := 0
+		if fields[2] == "1" {
+			score += 2
+		}
+
+		if fields[3] == "1" {
+			score++
+		}
+
+		if fields[5] == RoleEditor && score > roleScore {
+			byRole, roleScore = pane, score
+		}
+
+		if pane.Editor != "" && score > commandScore {
+			byCommand, commandScore = pane, score
+		}
+	}
+
+	if byRole != nil {
+		if byRole.Editor == "" {
+			return nil, fmt.Errorf("the editor pane %s is not running a supported editor", byRole.ID)
+		}
+
+		return byRole, nil
+	}
+
+	if byCommand != nil {
+		return byCommand, nil
+	}
+
+	return nil, errors.New("no pane has the editor role or is running a supported editor")
+}
+
+// OpenInEditor opens the file at path in the editor in pane, with the cursor
+// at line and col, and then focuses the pane.
+func (svc *Service) OpenInEditor(sessionName string, pane *EditorPane, path string, line, col uint64) error {
+	line, col = max(line, 1), max(col, 1)
+
+	opened := false
+
+	if pane.Editor == EditorNeovim && pane.Server != "" {
+		keys := fmt.Sprintf("<C-\\><C-N>:hide edit %s<CR>:call cursor(%d, %d)<CR>", strings.ReplaceAll(vimEscape(path), "<", "<lt>"), line, col)
+
+		// Typing into the pane is used instead if the server has gone away
+		opened = exec.Command("nvim", "--server", pane.Server, "--remote-send", keys).Run() == nil
+	}
+
+	cmds := tmux.Multi{}
+	if !opened {
+		cmds = append(cmds, editorKeys(pane.ID, pane.Editor, path, line, col)...)
+	}
+
+	cmds = append(cmds,
+		&tmux.SelectWindow{TargetWindow: pane.WindowID},
+		&tmux.SelectPane{TargetPane: pane.ID},
+	)
+
+	if err := svc.tmux.Run(cmds); err != nil {
+		return fmt.Errorf("OpenInEditor: %w", err)
+	}
+
+	// Show the session if it isn't the one the user is looking at
+	if tmux.InSession() {
+		return svc.AttachSession(sessionName)
+	}
+
+	return nil
+}
+
+// editorKeys returns the commands that type the keys that open the file at
+// path in an editor, with the cursor at line and col.
+func editorKeys(target, editor, path string, line, col uint64) []tmux.Command {
+	// Each editor is put in normal mode first, in case it is in the middle of
+	// inserting text
+	cmds := []tmux.Command{
+		&tmux.SendKeys{TargetPane: target, Keys: []string{"Escape"}},
+	}
+
+	switch editor {
+	case EditorNeovim, EditorVim:
+		cmds = append(cmds, sendLines(target, []string{
+			fmt.Sprintf(":hide edit %s | call cursor(%d, %d)", vimEscape(path), line, col),
+		})...)
+	case EditorHelix:
+		// Helix can only go to a line, so the cursor is moved to the column
+		// from the start of the line
+		cmds = append(cmds, sendLines(target, []string{
+			fmt.Sprintf(":open %s", helixQuote(path)),
+			fmt.Sprintf(":goto %d", line),
+		})...)
+
+		movement := "gh"
+		if col > 1 {
+			movement += fmt.Sprintf("%dl", col-1)
+		}
+
+		cmds = append(cmds, &tmux.SendKeys{TargetPane: target, Literal: true, Keys: []string{movement}})
+	case EditorKakoune:
+		cmds = append(cmds, sendLines(target, []string{
+			fmt.Sprintf(":edit %s %d %d", kakouneQuote(path), line, col),
+		})...)
+	}
+
+	return cmds
+}
+
+// vimEscape escapes the characters in a file name that are special in Vim's
+// command line, like fnameescape() does.
+func vimEscape(path string) string {
+	var b strings.Builder
+
+	for _, r := range path {
+		if strings.ContainsRune(" \t\n*?[{`$\\%#'\"|!<", r) {
+			b.WriteRune('\\')
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func helixQuote(path string) string {
+	if !strings.ContainsAny(path, " \t'\"`") {
+		return path
+	}
+
+	return `"` + strings.ReplaceAll(path, `"`, `\"`) + `"`
+}
+
+func kakouneQuote(path string) string {
+	return "'" + strings.ReplaceAll(path, "'", "''") + "'"
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/jamesbehr/torpedo/tmux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChooseEditorPane(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Output   string
+		Expected *EditorPane
+		Error    string
+	}{
+		{
+			Name:     "role",
+			Output:   "%1 @1 1 1 nvim  \n%2 @2 0 1 hx editor \n",
+			Expected: &EditorPane{ID: "%2", WindowID: "@2", Editor: EditorHelix},
+		},
+		{
+			Name:     "active pane",
+			Output:   "%1 @1 0 1 kak  \n%2 @2 1 0 vim.basic  \n%3 @2 1 1 nvim  /tmp/my nvim.sock\n",
+			Expected: &EditorPane{ID: "%3", WindowID: "@2", Editor: EditorNeovim, Server: "/tmp/my nvim.sock"},
+		},
+		{
+			Name:     "suffix",
+			Output:   "%1 @1 1 1 bash  \n%2 @1 1 0 vim.basic  \n",
+			Expected: &EditorPane{ID: "%2", WindowID: "@1", Editor: EditorVim},
+		},
+		{
+			Name:   "role without editor",
+			Output: "%1 @1 1 1 bash editor \n%2 @1 1 0 nvim  \n",
+			Error:  "the editor pane %1 is not running a supported editor",
+		},
+		{
+			Name:   "no editor",
+			Output: "%1 @1 1 1 bash  \n",
+			Error:  "no pane has the editor role or is running a supported editor",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			pane, err := chooseEditorPane(test.Output)
+			if test.Error != "" {
+				require.EqualError(t, err, test.Error)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, pane)
+		})
+	}
+}
+
+func TestEditorKeys(t *testing.T) {
+	escape := &tmux.SendKeys{TargetPane: "%1", Keys: []string{"Escape"}}
+	enter := &tmux.SendKeys{TargetPane: "%1", Keys: []string{"Enter"}}
+
+	tests := []struct {
+		Editor   string
+		Path     string
+		Col      uint64
+		Expected []tmux.Command
+	}{
+		{
+			Editor: EditorNeovim,
+			Path:   "/proj/my file#1.go",
+			Col:    4,
+			Expected: []tmux.Command{
+				escape,
+				&tmux.SendKeys{TargetPane: "%1", Literal: true, Keys: []string{`:hide edit /proj/my\ file\#1.go | call cursor(12, 4)`}},
+				enter,
+			},
+		},
+		{
+			Editor: EditorHelix,
+			Path:   "/proj/main.go",
+			Col:    4,
+			Expected: []tmux.Command{
+				escape,
+				&tmux.SendKeys{TargetPane: "%1", Literal: true, Keys: []string{":open /proj/main.go"}},
+				enter,
+				&tmux.SendKeys{TargetPane: "%1", Literal: true, Keys: []string{":goto 12"}},
+				enter,
+				&tmux.SendKeys{TargetPane: "%1", Literal: true, Keys: []string{"gh3l"}},
+			},
+		},
+		{
+			Editor: EditorHelix,
+			Path:   "/proj/my file.go",
+			Col:    1,
+			Expected: []tmux.Command{
+				escape,
+				&tmux.SendKeys{TargetPane: "%1", Literal: true, Keys: []string{`:open "/proj/my file.go"`}},
+				enter,
+				&tmux.SendKeys{TargetPane: "%1", Literal: true, Keys: []string{":goto 12"}},
+				enter,
+				&tmux.SendKeys{TargetPane: "%1", Literal: true, Keys: []string{"gh"}},
+			},
+		},
+		{
+			Editor: EditorKakoune,
+			Path:   "/proj/it's.go",
+			Col:    4,
+			Expected: []tmux.Command{
+				escape,
+				&tmux.SendKeys{TargetPane: "%1", Literal: true, Keys: []string{`:edit '/proj/it''s.go' 12 4`}},
+				enter,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Editor, func(t *testing.T) {
+			require.Equal(t, test.Expected, editorKeys("%1", test.Editor, test.Path, 12, test.Col))
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// branchMarksDir is the directory in the project data directory that holds
+// the file marks of each Git branch.
+const branchMarksDir = "branch-marks"
+
+// FileMarksPath returns the path of the file that the file marks of the
+// project at projectPath are stored in, and the branch they are for.
+// If the project config turns on branch_file_marks, each Git branch has its
+// own file marks, and the ones for the branch that is checked out are used.
+// Otherwise, or if no branch is checked out, the branch is empty and the
+// marks are shared by all branches.
+func (svc *Service) FileMarksPath(projectPath string) (string, string, error) {
+	enabled, err := svc.BranchFileMarks(projectPath)
+	if err != nil {
+		return "", "", fmt.Errorf("FileMarksPath: %w", err)
+	}
+
+	if enabled {
+		branch, err := GitBranch(projectPath)
+		if err != nil {
+			return "", "", fmt.Errorf("FileMarksPath: %w", err)
+		}
+
+		if branch != "" {
+			return svc.BranchFileMarksPath(projectPath, branch), branch, nil
+		}
+	}
+
+	return svc.ProjectDataFilePath(projectPath, "marks.json"), "", nil
+}
+
+// BranchFileMarks reports whether the project at projectPath keeps file
+// marks for each Git branch.
+// Projects without a config don't.
+// Only branch_file_marks is read from the config, so that file marks still
+// work when something else in it is invalid, but it is an error if the config
+// can't be parsed at all.
+func (svc *Service) BranchFileMarks(projectPath string) (bool, error) {
+	v := configValidator{}
+
+	root, err := svc.mergeProjectConfig(projectPath, &v)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if root == nil {
+		return false, &InvalidConfigError{v.issues}
+	}
+
+	enabled, _ := root.at("branch_file_marks").value.(bool)
+
+	return enabled, nil
+}
+
+// BranchFileMarksPath returns the path of the file that the file marks for
+// branch are stored in.
+// Branch names can contain slashes, so they are escaped.
+func (svc *Service) BranchFileMarksPath(projectPath, branch string) string {
+	return svc.ProjectDataFilePath(projectPath, filepath.Join(branchMarksDir, url.PathEscape(branch)+".json"))
+}
+
+// FileMarksBranches returns the sorted names of the branches that have file
+// marks stored for them in the project at projectPath.
+func (svc *Service) FileMarksBranches(projectPath string) ([]string, error) {
+	entries, err := os.ReadDir(svc.ProjectDataFilePath(projectPath, branchMarksDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("FileMarksBranches: %w", err)
+	}
+
+	branches := []string{}
+
+	// The directory also holds temporary files while marks are written
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		branch, err := url.PathUnescape(name)
+		if err != nil {
+			continue
+		}
+
+		branches = append(branches, branch)
+	}
+
+	slices.Sort(branches)
+
+	return branches, nil
+}
+
+// GitBranch returns the name of the Git branch that is checked out in the
+// repository containing dir, from its HEAD file.
+// It returns an empty string if dir isn't in a repository, or if HEAD is
+// detached.
+func GitBranch(dir string) (string, error) {
+	gitDir, err := findGitDir(dir)
+	if err != nil || gitDir == "" {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+
+	ref, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: ")
+	if !ok {
+		return "", nil
+	}
+
+	branch, _ := strings.CutPrefix(ref, "refs/heads/")
+
+	return branch, nil
+}
+
+// findGitDir finds the Git directory of the repository containing dir, by
+// looking for .git in dir and each of its parents.
+// In worktrees and submodules .git is a file that points to the Git
+// directory instead.
+func findGitDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		gitPath := filepath.Join(dir, ".git")
+
+		info, err := os.Stat(gitPath)
+		if err == nil {
+			if info.IsDir() {
+				return gitPath, nil
+			}
+
+			data, err := os.ReadFile(gitPath)
+			if err != nil {
+				return "", err
+			}
+
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+			if !ok {
+				return "", fmt.Errorf("%s does not point to a Git directory", gitPath)
+			}
+
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+
+			return gitDir, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+
+		dir = parent
+	}
+}
+
+// FileMarkPath returns the absolute path as a clean path relative to the
+// project at projectPath, which is how file marks store their files.
+// Symlinks are resolved first, so a file has the same path however it is
+// reached, and an error is returned if it isn't in the project.
+// The file doesn't have to exist.
+func (svc *Service) FileMarkPath(projectPath, path string) (string, error) {
+	root, err := resolveSymlinks(projectPath)
+	if err != nil {
+		return "", fmt.Errorf("FileMarkPath: %w", err)
+	}
+
+	resolved, err := resolveSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("FileMarkPath: %w", err)
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || !filepath.IsLocal(rel) || rel == "." {
+		return "", fmt.Errorf("%s is not in the project %s", path, projectPath)
+	}
+
+	return rel, nil
+}
+
+// resolveSymlinks is like [filepath.EvalSymlinks], but it only resolves the
+// part of path that exists.
+func resolveSymlinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+
+	resolved, err = resolveSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(resolved, filepath.Base(path)), nil
+}
+
+// FindProjectFiles returns the paths, relative to the project at projectPath,
+// of the files whose path ends with the relative path name.
+// Files that Git ignores aren't searched.
+func (svc *Service) FindProjectFiles(projectPath, name string) ([]string, error) {
+	filter, err := newWatchFilter(projectPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("FindProjectFiles: %w", err)
+	}
+
+	suffix := "/" + filepath.ToSlash(name)
+	found := []string{}
+
+	err = filepath.WalkDir(projectPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(projectPath, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if d.IsDir() {
+			if filter.skipDir(rel) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if filter.matches(rel) && strings.HasSuffix("/"+filepath.ToSlash(rel), suffix) {
+			found = append(found, rel)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("FindProjectFiles: %w", err)
+	}
+
+	return found, nil
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitBranch(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Files    map[string]string
+		Expected string
+	}{
+		{
+			Name:     "branch",
+			Files:    map[string]string{".git/HEAD": "ref: refs/heads/feature/marks\n"},
+			Expected: "feature/marks",
+		},
+		{
+			Name:     "detached",
+			Files:    map[string]string{".git/HEAD": "3f1c2a9d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39\n"},
+			Expected: "",
+		},
+		{
+			Name: "worktree",
+			Files: map[string]string{
+				".git":                             "gitdir: ../repo/.git/worktrees/work\n",
+				"../repo/.git/worktrees/work/HEAD": "ref: refs/heads/work\n",
+			},
+			Expected: "work",
+		},
+		{
+			Name:     "not a repository",
+			Files:    map[string]string{},
+			Expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "project")
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+
+			for name, content := range test.Files {
+				path := filepath.Join(dir, name)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+			}
+
+			branch, err := GitBranch(filepath.Join(dir, "sub"))
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, branch)
+		})
+	}
+}
+
+func TestFileMarksPath(t *testing.T) {
+	dir := t.TempDir()
+	svc := New("")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, projectDataDir), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/feature/a\n"), 0644))
+
+	// Without a config the marks are shared
+	path, branch, err := svc.FileMarksPath(dir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, projectDataDir, "marks.json"), path)
+	require.Equal(t, "", branch)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, projectDataDir, "config.json"), []byte(`{"branch_file_marks": true}`), 0644))
+
+	path, branch, err = svc.FileMarksPath(dir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, projectDataDir, "branch-marks", "feature%2Fa.json"), path)
+	require.Equal(t, "feature/a", branch)
+
+	// Problems in the rest of the config don't stop file marks from working
+	invalid := `{"branch_file_marks": true, "windows": [{"layout": "tilde"}], "commands": {"a": {"deps": ["a"]}, "b": {"run": "x", "watch": ["["]}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, projectDataDir, "config.json"), []byte(invalid), 0644))
+
+	_, err = svc.ParseProjectConfig(dir)
+	require.Error(t, err)
+
+	invalidPath, branch, err := svc.FileMarksPath(dir)
+	require.NoError(t, err)
+	require.Equal(t, path, invalidPath)
+	require.Equal(t, "feature/a", branch)
+
+	// The setting can't be read from a config that can't be parsed
+	require.NoError(t, os.WriteFile(filepath.Join(dir, projectDataDir, "config.json"), []byte(`{"branch_file_marks": tru`), 0644))
+
+	_, _, err = svc.FileMarksPath(dir)
+	require.Error(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0644))
+	// Lock files that older versions left next to the marks are ignored
+	require.NoError(t, os.WriteFile(path+".lock", nil, 0644))
+	require.NoError(t, os.WriteFile(svc.BranchFileMarksPath(dir, "main"), []byte("{}"), 0644))
+
+	branches, err := svc.FileMarksBranches(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"feature/a", "main"}, branches)
+}
+
+func TestFileMarkPath(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "project")
+	outside := filepath.Join(root, "outside")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.MkdirAll(outside, 0755))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "sub"), filepath.Join(dir, "link")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "escape")))
+	require.NoError(t, os.Symlink(dir, filepath.Join(root, "alias")))
+
+	tests := []struct {
+		Name     string
+		Path     string
+		Expected string
+		Error    bool
+	}{
+		{Name: "file", Path: filepath.Join(dir, "sub", "main.go"), Expected: filepath.Join("sub", "main.go")},
+		{Name: "unclean", Path: dir + "/sub/../sub/./main.go", Expected: filepath.Join("sub", "main.go")},
+		{Name: "symlink", Path: filepath.Join(dir, "link", "main.go"), Expected: filepath.Join("sub", "main.go")},
+		{Name: "project through symlink", Path: filepath.Join(root, "alias", "main.go"), Expected: "main.go"},
+		{Name: "outside", Path: filepath.Join(outside, "main.go"), Error: true},
+		{Name: "symlink outside", Path: filepath.Join(dir, "escape", "main.go"), Error: true},
+		{Name: "project", Path: dir, Error: true},
+	}
+
+	svc := New("")
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			rel, err := svc.FileMarkPath(dir, test.Path)
+			if test.Error {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, rel)
+		})
+	}
+}
+
+func TestFindProjectFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"a/main.go", "b/main.go", "b/c/util.go", "build/util.go", ".git/util.go"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("build/\n"), 0644))
+
+	svc := New("")
+
+	found, err := svc.FindProjectFiles(dir, "main.go")
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join("a", "main.go"), filepath.Join("b", "main.go")}, found)
+
+	found, err = svc.FindProjectFiles(dir, "util.go")
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join("b", "c", "util.go")}, found)
+
+	found, err = svc.FindProjectFiles(dir, "c/util.go")
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join("b", "c", "util.go")}, found)
+}
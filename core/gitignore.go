@@ -0,0 +1,189 @@
+package core
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignore matches paths against the patterns in .gitignore files.
+// Paths are relative to the root of the project and use forward slashes.
+type gitignore struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	// base is the directory containing the .gitignore file, or "" for the
+	// root of the project
+	base    string
+	pattern string
+	// anchored patterns are matched against the whole path relative to base,
+	// rather than just the last element
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// loadGitignore reads every .gitignore file in the project, skipping
+// directories that are ignored by the files that have been read so far.
+func loadGitignore(root string) (*gitignore, error) {
+	g := &gitignore{}
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		} else if d.Name() == ".git" || g.ignored(rel, true) {
+			return filepath.SkipDir
+		}
+
+		return g.read(filepath.Join(p, ".gitignore"), rel)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// read adds the patterns in a .gitignore file in the directory base.
+// It does nothing if the file does not exist.
+func (g *gitignore) read(file, base string) error {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		g.add(base, scanner.Text())
+	}
+
+	return scanner.Err()
+}
+
+// add adds a single line of a .gitignore file in the directory base.
+func (g *gitignore) add(base, line string) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	p := ignorePattern{base: base}
+
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// A slash anywhere but the end anchors the pattern to base
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	p.pattern = line
+	g.patterns = append(g.patterns, p)
+}
+
+// ignored reports whether rel is ignored, assuming that none of its parent
+// directories are.
+// As in Git, the last pattern that matches wins.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	ignored := false
+
+	for _, p := range g.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+
+		name := rel
+		if p.base != "" {
+			if !strings.HasPrefix(rel, p.base+"/") {
+				continue
+			}
+
+			name = strings.TrimPrefix(rel, p.base+"/")
+		}
+
+		if !p.anchored {
+			name = path.Base(name)
+		}
+
+		if matchGlob(p.pattern, name) {
+			ignored = !p.negate
+		}
+	}
+
+	return ignored
+}
+
+// matchGlob reports whether name matches pattern, where both are slash
+// separated paths.
+// Each element of pattern is matched with [path.Match], except for "**",
+// which matches any number of elements.
+func matchGlob(pattern, name string) bool {
+	return matchGlobElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobElements(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobElements(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// checkGlob returns an error if pattern is not a valid glob for matchGlob.
+func checkGlob(pattern string) error {
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
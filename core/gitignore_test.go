@@ -0,0 +1,71 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		Pattern  string
+		Name     string
+		Expected bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "core/main.go", false},
+		{"core/*.go", "core/main.go", true},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "core/testdata/main.go", true},
+		{"core/**", "core/testdata/main.go", true},
+		{"core/**/main.go", "core/main.go", true},
+		{"core/**/main.go", "cmd/main.go", false},
+		{"[a-c]*.txt", "b.txt", true},
+		{"?.txt", "ab.txt", false},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.Expected, matchGlob(test.Pattern, test.Name), "%s %s", test.Pattern, test.Name)
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "web", "dist"), 0777))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "build", "sub"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("# build output\n*.log\n!keep.log\n/build/\ntmp\n"), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "web", ".gitignore"), []byte("dist/\n/*.css\n"), 0666))
+	// Files in ignored directories are never read
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "build", "sub", ".gitignore"), []byte("*.go\n"), 0666))
+
+	g, err := loadGitignore(dir)
+	require.NoError(t, err)
+
+	tests := []struct {
+		Path     string
+		IsDir    bool
+		Expected bool
+	}{
+		{"main.go", false, false},
+		{"debug.log", false, true},
+		{"web/debug.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"web/build", true, false},
+		{"tmp", false, true},
+		{"web/tmp", true, true},
+		{"web/dist", true, true},
+		{"dist", true, false},
+		{"web/app.css", false, true},
+		{"web/css/app.css", false, false},
+		{"app.css", false, false},
+		{"build/sub/main.go", false, false},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.Expected, g.ignored(test.Path, test.IsDir), test.Path)
+	}
+}
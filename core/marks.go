@@ -0,0 +1,96 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jamesbehr/torpedo/marks"
+)
+
+const marksMenuHeader = `# Each line is a mark, with its key and then its project.
+# Reorder, change or delete the lines to change your marks.
+# Lines with only a project get the next free number as their key.
+# Anything after a # at the start of a line or after a space is a comment.
+`
+
+// FormatMarksMenu returns the text that is edited to change marks, with one
+// mark on each line.
+func FormatMarksMenu(m marks.Marks) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(marksMenuHeader)
+
+	for _, mark := range m {
+		fmt.Fprintf(&buf, "%s %s\n", mark.Key, mark.Project)
+	}
+
+	return buf.Bytes()
+}
+
+// CheckMarkKey returns an error if key can't be a mark key, because
+// [ParseMarksMenu] would read it as part of a project or a comment.
+func CheckMarkKey(key string) error {
+	if key == "" || strings.ContainsAny(key, "/~ \t") || strings.HasPrefix(key, "#") {
+		return fmt.Errorf("invalid mark key %q, keys can't be empty, start with # or contain /, ~ or spaces", key)
+	}
+
+	return nil
+}
+
+// ParseMarksMenu reads marks from the text returned by [FormatMarksMenu] after
+// it has been edited, in the order of the lines.
+func ParseMarksMenu(data []byte) (marks.Marks, error) {
+	m := marks.Marks{}
+
+	// Marks without keys are numbered after all the other keys are known, so
+	// that they don't take a key that is used by a later line
+	unkeyed := map[int]bool{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := cleanMarkLine(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// Keys can't look like paths, so a line with only a project whose
+		// path has spaces in it isn't split up
+		end := strings.IndexAny(line, " \t")
+		if end < 0 || strings.ContainsAny(line[:end], "/~") {
+			unkeyed[len(m)] = true
+			m = append(m, marks.Mark{Project: line})
+			continue
+		}
+
+		key, project := line[:end], strings.TrimSpace(line[end:])
+
+		if m.Index(key) >= 0 {
+			return nil, fmt.Errorf("ParseMarksMenu: line %d: duplicate key %q", lineNumber, key)
+		}
+
+		m = append(m, marks.Mark{Key: key, Project: project})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ParseMarksMenu: %w", err)
+	}
+
+	for i := range m {
+		if unkeyed[i] {
+			m[i].Key = m.NextFreeKey()
+		}
+	}
+
+	return m, nil
+}
+
+// markComment matches a comment, which starts with a # at the start of the
+// line or after whitespace, so that paths can contain #.
+var markComment = regexp.MustCompile(`(^|\s)#.*$`)
+
+func cleanMarkLine(line string) string {
+	return strings.TrimSpace(markComment.ReplaceAllString(line, ""))
+}
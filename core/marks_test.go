@@ -0,0 +1,87 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/jamesbehr/torpedo/marks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarksMenu(t *testing.T) {
+	m := marks.Marks{{Key: "0", Project: "~/a"}, {Key: "foo", Project: "~/My Projects/foo"}}
+
+	parsed, err := ParseMarksMenu(FormatMarksMenu(m))
+	require.NoError(t, err)
+	require.Equal(t, m, parsed)
+
+	tests := []struct {
+		Name     string
+		Menu     string
+		Expected marks.Marks
+		Error    string
+	}{
+		{
+			Name: "reordered",
+			Menu: "# comment\n\nfoo ~/foo  # trailing comment\n0\t~/a\n",
+			Expected: marks.Marks{
+				{Key: "foo", Project: "~/foo"},
+				{Key: "0", Project: "~/a"},
+			},
+		},
+		{
+			Name: "without keys",
+			Menu: "~/b\n0 ~/a\n~/c\n2 ~/d\n",
+			Expected: marks.Marks{
+				{Key: "1", Project: "~/b"},
+				{Key: "0", Project: "~/a"},
+				{Key: "3", Project: "~/c"},
+				{Key: "2", Project: "~/d"},
+			},
+		},
+		{
+			Name: "paths with spaces and without keys",
+			Menu: "~/My Projects/foo\n/srv/My Projects/bar\nfoo ~/My Projects/baz\n",
+			Expected: marks.Marks{
+				{Key: "0", Project: "~/My Projects/foo"},
+				{Key: "1", Project: "/srv/My Projects/bar"},
+				{Key: "foo", Project: "~/My Projects/baz"},
+			},
+		},
+		{
+			Name: "paths with #",
+			Menu: "#0 ~/a\nc# ~/c#sharp # comment\n~/issue#12\t# comment\n",
+			Expected: marks.Marks{
+				{Key: "c#", Project: "~/c#sharp"},
+				{Key: "0", Project: "~/issue#12"},
+			},
+		},
+		{
+			Name:  "duplicate keys",
+			Menu:  "0 ~/a\n\n0 ~/b\n",
+			Error: `ParseMarksMenu: line 3: duplicate key "0"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			m, err := ParseMarksMenu([]byte(test.Menu))
+			if test.Error != "" {
+				require.EqualError(t, err, test.Error)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, m)
+		})
+	}
+}
+
+func TestCheckMarkKey(t *testing.T) {
+	for _, key := range []string{"0", "foo", "c#", "a-b"} {
+		require.NoError(t, CheckMarkKey(key), key)
+	}
+
+	for _, key := range []string{"", "a/b", "~", "a b", "#a"} {
+		require.Error(t, CheckMarkKey(key), key)
+	}
+}
@@ -0,0 +1,268 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type nodeKind int
+
+const (
+	nodeNull nodeKind = iota
+	nodeBool
+	nodeNumber
+	nodeString
+	nodeArray
+	nodeObject
+)
+
+func (k nodeKind) String() string {
+	switch k {
+	case nodeBool:
+		return "a boolean"
+	case nodeNumber:
+		return "a number"
+	case nodeString:
+		return "a string"
+	case nodeArray:
+		return "an array"
+	case nodeObject:
+		return "an object"
+	default:
+		return "null"
+	}
+}
+
+// node is a parsed config value that remembers where it came from in the
+// config file, so that problems can be reported with a line and column.
+type node struct {
+	kind   nodeKind
+	file   string
+	line   int
+	column int
+	value  any
+	items  []*node
+	fields []nodeField
+}
+
+type nodeField struct {
+	key     string
+	keyNode *node
+	value   *node
+}
+
+// at finds the descendant of the node at path, where each element of path is
+// either a string object key or an int array index.
+// If there is no such node, it returns the closest ancestor that exists, so
+// problems are still reported near the right place.
+func (n *node) at(path ...any) *node {
+	for _, elem := range path {
+		if n == nil {
+			return nil
+		}
+
+		var next *node
+
+		switch elem := elem.(type) {
+		case string:
+			for _, field := range n.fields {
+				if field.key == elem {
+					next = field.value
+				}
+			}
+		case int:
+			if elem >= 0 && elem < len(n.items) {
+				next = n.items[elem]
+			}
+		}
+
+		if next == nil {
+			return n
+		}
+
+		n = next
+	}
+
+	return n
+}
+
+// setFile records that n and all of its descendants came from file.
+func (n *node) setFile(file string) {
+	n.file = file
+
+	for _, item := range n.items {
+		item.setFile(file)
+	}
+
+	for _, field := range n.fields {
+		field.keyNode.setFile(file)
+		field.value.setFile(file)
+	}
+}
+
+// toInterface converts the node into the same types that [json.Unmarshal]
+// uses for an interface value.
+func (n *node) toInterface() any {
+	switch n.kind {
+	case nodeArray:
+		items := make([]any, len(n.items))
+		for i, item := range n.items {
+			items[i] = item.toInterface()
+		}
+
+		return items
+	case nodeObject:
+		fields := make(map[string]any, len(n.fields))
+		for _, field := range n.fields {
+			fields[field.key] = field.value.toInterface()
+		}
+
+		return fields
+	default:
+		return n.value
+	}
+}
+
+// decode stores the value of the node in the value pointed to by v, as if it
+// was decoded from JSON.
+func (n *node) decode(v any) error {
+	data, err := json.Marshal(n.toInterface())
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// syntaxError is returned when a config file cannot be parsed.
+type syntaxError struct {
+	line   int
+	column int
+	err    error
+}
+
+func (err *syntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", err.line, err.column, err.err)
+}
+
+// parseJSONNode parses data as a single JSON value.
+// If data is not valid JSON, it returns a [syntaxError].
+func parseJSONNode(data []byte) (*node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	n, err := readJSONNode(dec, data)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return n, nil
+		} else if err == nil {
+			err = errors.New("unexpected data after top-level value")
+		}
+	}
+
+	offset := skipJSONSeparators(data, int(dec.InputOffset()))
+
+	var jsonErr *json.SyntaxError
+	if errors.As(err, &jsonErr) && jsonErr.Offset > 0 {
+		// The offset is just after the invalid character
+		offset = int(jsonErr.Offset) - 1
+	}
+
+	line, column := lineColumn(data, offset)
+
+	return nil, &syntaxError{line, column, err}
+}
+
+func readJSONNode(dec *json.Decoder, data []byte) (*node, error) {
+	n := &node{}
+	n.line, n.column = lineColumn(data, skipJSONSeparators(data, int(dec.InputOffset())))
+
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			n.kind = nodeObject
+
+			for dec.More() {
+				key, err := readJSONNode(dec, data)
+				if err != nil {
+					return nil, err
+				}
+
+				value, err := readJSONNode(dec, data)
+				if err != nil {
+					return nil, err
+				}
+
+				n.fields = append(n.fields, nodeField{key.value.(string), key, value})
+			}
+		case '[':
+			n.kind = nodeArray
+
+			for dec.More() {
+				item, err := readJSONNode(dec, data)
+				if err != nil {
+					return nil, err
+				}
+
+				n.items = append(n.items, item)
+			}
+		}
+
+		// Consume the closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	case bool:
+		n.kind = nodeBool
+		n.value = tok
+	case json.Number:
+		n.kind = nodeNumber
+		n.value = tok
+	case string:
+		n.kind = nodeString
+		n.value = tok
+	case nil:
+		n.kind = nodeNull
+	}
+
+	return n, nil
+}
+
+// skipJSONSeparators returns the offset of the next token in data after
+// offset, skipping whitespace and the separators that [json.Decoder] skips
+// when it reads a token.
+func skipJSONSeparators(data []byte, offset int) int {
+	for offset < len(data) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+
+	return offset
+}
+
+// lineColumn converts a byte offset in data to a 1-based line and column.
+func lineColumn(data []byte, offset int) (int, int) {
+	offset = min(offset, len(data))
+	before := data[:offset]
+	line := bytes.Count(before, []byte{'\n'}) + 1
+	column := offset - bytes.LastIndexByte(before, '\n')
+
+	return line, column
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalJSON encodes the node as JSON, keeping the fields of objects in the
+// order they were in the original file.
+func (n *node) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch n.kind {
+	case nodeObject:
+		buf.WriteByte('{')
+
+		for i, field := range n.fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			key, err := json.Marshal(field.key)
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := field.value.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+
+		buf.WriteByte('}')
+	case nodeArray:
+		buf.WriteByte('[')
+
+		for i, item := range n.items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			value, err := item.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+
+			buf.Write(value)
+		}
+
+		buf.WriteByte(']')
+	default:
+		return json.Marshal(n.value)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// yamlNode converts the node into a YAML node, keeping the fields of objects
+// in the order they were in the original file.
+func (n *node) yamlNode() *yaml.Node {
+	switch n.kind {
+	case nodeObject:
+		y := &yaml.Node{Kind: yaml.MappingNode}
+		for _, field := range n.fields {
+			y.Content = append(y.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: field.key}, field.value.yamlNode())
+		}
+
+		return y
+	case nodeArray:
+		y := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range n.items {
+			y.Content = append(y.Content, item.yamlNode())
+		}
+
+		return y
+	case nodeBool:
+		if n.value.(bool) {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"}
+		}
+
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "false"}
+	case nodeNumber:
+		number := n.value.(json.Number).String()
+		if strings.ContainsAny(number, ".eE") {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: number}
+		}
+
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: number}
+	case nodeString:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: n.value.(string)}
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	}
+}
+
+func (n *node) marshalYAML() ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(n.yamlNode()); err != nil {
+		return nil, err
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// tomlValue converts the node into values that can be encoded as TOML.
+// TOML has no null, so null values are left out.
+func (n *node) tomlValue() any {
+	switch n.kind {
+	case nodeObject:
+		fields := map[string]any{}
+		for _, field := range n.fields {
+			if field.value.kind != nodeNull {
+				fields[field.key] = field.value.tomlValue()
+			}
+		}
+
+		return fields
+	case nodeArray:
+		items := []any{}
+		for _, item := range n.items {
+			if item.kind != nodeNull {
+				items = append(items, item.tomlValue())
+			}
+		}
+
+		return items
+	case nodeNumber:
+		number := n.value.(json.Number)
+		if i, err := number.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := number.Float64()
+		return f
+	default:
+		return n.value
+	}
+}
+
+// marshalTOML encodes the node as TOML.
+// Unlike the other formats, the fields of objects are sorted by name.
+func (n *node) marshalTOML() ([]byte, error) {
+	return toml.Marshal(n.tomlValue())
+}
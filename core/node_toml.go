@@ -0,0 +1,259 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// parseTOMLNode parses data as a TOML document.
+// If data is not valid TOML, it returns a [syntaxError].
+// It uses go-toml's unstable parser, since decoding with the stable API
+// doesn't say where each value is, which the config issues need.
+// This file is the only user of the unstable API, which has no compatibility
+// promise, so go-toml is pinned in go.mod and TestParseTOMLNode and
+// TestParseTOMLNodeMatchesDecoder must pass before the pin is raised.
+func parseTOMLNode(data []byte) (*node, error) {
+	b := tomlBuilder{defined: map[*node]bool{}}
+	b.parser.Reset(data)
+
+	root := &node{kind: nodeObject, line: 1, column: 1}
+	current := root
+
+	for b.parser.NextExpression() {
+		expr := b.parser.Expression()
+
+		var err error
+
+		switch expr.Kind {
+		case unstable.KeyValue:
+			err = b.setKeyValue(current, expr)
+		case unstable.Table:
+			current, err = b.table(root, expr.Key(), false)
+		case unstable.ArrayTable:
+			current, err = b.table(root, expr.Key(), true)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.parser.Error(); err != nil {
+		var parserErr *unstable.ParserError
+		if errors.As(err, &parserErr) && parserErr.Highlight != nil {
+			offset := b.parser.Range(parserErr.Highlight).Offset
+			line, column := lineColumn(data, int(offset))
+			return nil, &syntaxError{line, column, err}
+		}
+
+		return nil, &syntaxError{0, 0, err}
+	}
+
+	return root, nil
+}
+
+type tomlBuilder struct {
+	parser unstable.Parser
+	// defined holds the tables that have been defined by a header or a
+	// dotted key, which can't be defined again by a header
+	defined map[*node]bool
+}
+
+// newNode creates a node positioned at the start of a TOML node.
+func (b *tomlBuilder) newNode(n *unstable.Node, kind nodeKind) *node {
+	start := b.parser.Shape(n.Raw).Start
+	return &node{kind: kind, line: start.Line, column: start.Column}
+}
+
+// newValueNode is like newNode, but some values do not record where they are,
+// so those are positioned at parent instead.
+func (b *tomlBuilder) newValueNode(n *unstable.Node, kind nodeKind, parent *node) *node {
+	if n.Raw.Length == 0 {
+		return &node{kind: kind, line: parent.line, column: parent.column}
+	}
+
+	return b.newNode(n, kind)
+}
+
+func (b *tomlBuilder) errorf(n *unstable.Node, format string, args ...any) error {
+	start := b.parser.Shape(n.Raw).Start
+	return &syntaxError{start.Line, start.Column, fmt.Errorf(format, args...)}
+}
+
+// child finds the object that a dotted key part refers to, creating it if it
+// does not exist.
+// If the key refers to an array of tables, the last table is used.
+func (b *tomlBuilder) child(parent *node, key *unstable.Node) (*node, error) {
+	name := string(key.Data)
+
+	child := parent.at(name)
+	if child == parent {
+		child = b.newNode(key, nodeObject)
+		keyNode := b.newNode(key, nodeString)
+		keyNode.value = name
+		parent.fields = append(parent.fields, nodeField{name, keyNode, child})
+	}
+
+	if child.kind == nodeArray && len(child.items) > 0 {
+		child = child.items[len(child.items)-1]
+	}
+
+	if child.kind != nodeObject {
+		return nil, b.errorf(key, "key %q is already defined as a value", name)
+	}
+
+	return child, nil
+}
+
+// table finds or creates the table for a [table] or [[array]] header.
+func (b *tomlBuilder) table(root *node, keys unstable.Iterator, array bool) (*node, error) {
+	current := root
+
+	for keys.Next() {
+		key := keys.Node()
+
+		if !keys.IsLast() || !array {
+			if keys.IsLast() && current.at(string(key.Data)).kind == nodeArray {
+				return nil, b.errorf(key, "key %q is already defined as an array", string(key.Data))
+			}
+
+			child, err := b.child(current, key)
+			if err != nil {
+				return nil, err
+			}
+
+			current = child
+
+			if keys.IsLast() {
+				if b.defined[current] {
+					return nil, b.errorf(key, "table %q is already defined", string(key.Data))
+				}
+
+				b.defined[current] = true
+			}
+
+			continue
+		}
+
+		name := string(key.Data)
+
+		tables := current.at(name)
+		if tables == current {
+			tables = b.newNode(key, nodeArray)
+			keyNode := b.newNode(key, nodeString)
+			keyNode.value = name
+			current.fields = append(current.fields, nodeField{name, keyNode, tables})
+		} else if tables.kind != nodeArray {
+			return nil, b.errorf(key, "key %q is already defined as a value", name)
+		}
+
+		table := b.newNode(key, nodeObject)
+		tables.items = append(tables.items, table)
+		current = table
+	}
+
+	return current, nil
+}
+
+func (b *tomlBuilder) setKeyValue(current *node, expr *unstable.Node) error {
+	keys := expr.Key()
+
+	for keys.Next() {
+		key := keys.Node()
+
+		if !keys.IsLast() {
+			child, err := b.child(current, key)
+			if err != nil {
+				return err
+			}
+
+			current = child
+			b.defined[current] = true
+			continue
+		}
+
+		name := string(key.Data)
+		if current.at(name) != current {
+			return b.errorf(key, "key %q is already defined", name)
+		}
+
+		keyNode := b.newNode(key, nodeString)
+		keyNode.value = name
+
+		value, err := b.value(expr.Value(), keyNode)
+		if err != nil {
+			return err
+		}
+
+		current.fields = append(current.fields, nodeField{name, keyNode, value})
+	}
+
+	return nil
+}
+
+func (b *tomlBuilder) value(v *unstable.Node, parent *node) (*node, error) {
+	switch v.Kind {
+	case unstable.Array:
+		n := b.newValueNode(v, nodeArray, parent)
+
+		items := v.Children()
+		for items.Next() {
+			item, err := b.value(items.Node(), n)
+			if err != nil {
+				return nil, err
+			}
+
+			n.items = append(n.items, item)
+		}
+
+		return n, nil
+	case unstable.InlineTable:
+		n := b.newValueNode(v, nodeObject, parent)
+
+		fields := v.Children()
+		for fields.Next() {
+			if err := b.setKeyValue(n, fields.Node()); err != nil {
+				return nil, err
+			}
+		}
+
+		return n, nil
+	case unstable.Bool:
+		n := b.newValueNode(v, nodeBool, parent)
+		n.value = string(v.Data) == "true"
+		return n, nil
+	case unstable.Integer:
+		s := strings.ReplaceAll(string(v.Data), "_", "")
+
+		i, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return nil, b.errorf(v, "invalid integer %s", v.Data)
+		}
+
+		n := b.newValueNode(v, nodeNumber, parent)
+		n.value = json.Number(strconv.FormatInt(i, 10))
+		return n, nil
+	case unstable.Float:
+		s := strings.ReplaceAll(string(v.Data), "_", "")
+
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, b.errorf(v, "unsupported number %s", v.Data)
+		}
+
+		n := b.newValueNode(v, nodeNumber, parent)
+		n.value = json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+		return n, nil
+	default:
+		// Strings and dates are both treated as strings
+		n := b.newValueNode(v, nodeString, parent)
+		n.value = string(v.Data)
+		return n, nil
+	}
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// The TOML parser is go-toml's unstable API, which can change in any release,
+// so these cover the positions and values that come from it.
+func TestParseTOMLNode(t *testing.T) {
+	data := "name = \"app\"\n" +
+		"size = 1_000\n" +
+		"ratio = 0.5\n" +
+		"on = true\n" +
+		"date = 2024-01-02\n" +
+		"tags = [\"a\", 2]\n" +
+		"env = { FOO = \"bar\" }\n" +
+		"a.b.c = 1\n" +
+		"\n" +
+		"[commands.test]\n" +
+		"run = \"go test\"\n" +
+		"\n" +
+		"[[windows]]\n" +
+		"name = \"editor\"\n" +
+		"\n" +
+		"[[windows]]\n" +
+		"  name = \"shell\"\n"
+
+	root, err := parseTOMLNode([]byte(data))
+	require.NoError(t, err)
+
+	tests := []struct {
+		Path   []any
+		Kind   nodeKind
+		Value  any
+		Line   int
+		Column int
+	}{
+		{[]any{"name"}, nodeString, "app", 1, 8},
+		{[]any{"size"}, nodeNumber, json.Number("1000"), 2, 8},
+		{[]any{"ratio"}, nodeNumber, json.Number("0.5"), 3, 9},
+		// Booleans, dates and arrays don't record where they are, so they
+		// are positioned at their key
+		{[]any{"on"}, nodeBool, true, 4, 1},
+		{[]any{"date"}, nodeString, "2024-01-02", 5, 1},
+		{[]any{"tags"}, nodeArray, nil, 6, 1},
+		{[]any{"tags", 0}, nodeString, "a", 6, 9},
+		{[]any{"tags", 1}, nodeNumber, json.Number("2"), 6, 14},
+		{[]any{"env", "FOO"}, nodeString, "bar", 7, 15},
+		{[]any{"a", "b", "c"}, nodeNumber, json.Number("1"), 8, 9},
+		{[]any{"commands", "test"}, nodeObject, nil, 10, 11},
+		{[]any{"commands", "test", "run"}, nodeString, "go test", 11, 7},
+		{[]any{"windows", 0}, nodeObject, nil, 13, 3},
+		{[]any{"windows", 1, "name"}, nodeString, "shell", 17, 10},
+	}
+
+	for _, test := range tests {
+		n := root.at(test.Path...)
+		require.Equal(t, test.Kind, n.kind, "kind at %v", test.Path)
+		require.Equal(t, test.Line, n.line, "line at %v", test.Path)
+		require.Equal(t, test.Column, n.column, "column at %v", test.Path)
+
+		if test.Value != nil {
+			require.Equal(t, test.Value, n.value, "value at %v", test.Path)
+		}
+	}
+
+	errors := []struct {
+		Data   string
+		Line   int
+		Column int
+	}{
+		{"a = 1\na = 2\n", 2, 1},
+		{"a = 1\n[a]\n", 2, 2},
+		{"[a]\n[a]\n", 2, 2},
+		{"[[a]]\n[a]\n", 2, 2},
+		{"a = 1\nb = \n", 2, 5},
+		{"a = inf\n", 1, 5},
+	}
+
+	for _, test := range errors {
+		_, err := parseTOMLNode([]byte(test.Data))
+
+		var syntaxErr *syntaxError
+		require.ErrorAs(t, err, &syntaxErr, "parseTOMLNode(%q)", test.Data)
+		require.Equal(t, test.Line, syntaxErr.line, "line of %q", test.Data)
+		require.Equal(t, test.Column, syntaxErr.column, "column of %q", test.Data)
+	}
+}
+
+// The values from the unstable parser should match what the stable decoder
+// gives, so that a change to either in a new release of go-toml is noticed.
+func TestParseTOMLNodeMatchesDecoder(t *testing.T) {
+	documents := []string{
+		"name = \"app\"\nsize = 1_000\nhex = 0xff\noctal = 0o17\nbinary = 0b101\n",
+		"ratio = 0.5\nexp = 1e3\nneg = -2.5E-2\non = true\noff = false\n",
+		"basic = \"a\\tb \\u00e9\"\nliteral = 'C:\\path'\nmulti = \"\"\"\none\ntwo\"\"\"\nraw = '''\nx\\y'''\n",
+		"date = 2024-01-02\ntime = 07:32:00\nlocal = 1979-05-27T07:32:00\n",
+		"tags = [\"a\", 2, [true], { b = 1 }]\nenv = { FOO = \"bar\", a.b = 2 }\n",
+		"a.b.c = 1\n\"quoted key\" = 2\n[x.y]\nz = 3\n[x]\nw = 4\n",
+		"[[windows]]\nname = \"editor\"\n[[windows.panes]]\ncmd = [\"nvim\"]\n[[windows]]\nname = \"shell\"\n",
+	}
+
+	for _, data := range documents {
+		root, err := parseTOMLNode([]byte(data))
+		require.NoError(t, err, "parseTOMLNode(%q)", data)
+
+		var decoded map[string]any
+		require.NoError(t, toml.Unmarshal([]byte(data), &decoded), "toml.Unmarshal(%q)", data)
+
+		expected, err := json.Marshal(decoded)
+		require.NoError(t, err)
+
+		actual, err := json.Marshal(root.toInterface())
+		require.NoError(t, err)
+
+		require.JSONEq(t, string(expected), string(actual), "parseTOMLNode(%q)", data)
+	}
+
+	invalid := []string{
+		"a = 1\na = 2\n",
+		"a = 1\n[a]\n",
+		"[a]\n[a]\n",
+		"a = [1,\n",
+		"a = \"unterminated\n",
+		"a.b = 1\na = 2\n",
+		"a.b = 1\n[a]\n",
+		"[a]\nb.c = 1\n[a.b]\n",
+		"[[a]]\n[a]\n",
+	}
+
+	for _, data := range invalid {
+		var decoded map[string]any
+		require.Error(t, toml.Unmarshal([]byte(data), &decoded), "toml.Unmarshal(%q)", data)
+
+		_, err := parseTOMLNode([]byte(data))
+		require.Error(t, err, "parseTOMLNode(%q)", data)
+	}
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+var yamlErrorPattern = regexp.MustCompile(`^yaml: line ([0-9]+): (.*)$`)
+
+// parseYAMLNode parses data as a single YAML document.
+// If data is not valid YAML, it returns a [syntaxError].
+func parseYAMLNode(data []byte) (*node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		if match := yamlErrorPattern.FindStringSubmatch(err.Error()); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			return nil, &syntaxError{line, 0, errors.New(match[2])}
+		}
+
+		return nil, &syntaxError{0, 0, err}
+	}
+
+	// An empty document is treated like an empty object
+	if len(doc.Content) == 0 {
+		return &node{kind: nodeObject, line: 1, column: 1}, nil
+	}
+
+	return convertYAMLNode(doc.Content[0])
+}
+
+func convertYAMLNode(y *yaml.Node) (*node, error) {
+	n := &node{line: y.Line, column: y.Column}
+
+	switch y.Kind {
+	case yaml.AliasNode:
+		alias, err := convertYAMLNode(y.Alias)
+		if err != nil {
+			return nil, err
+		}
+
+		alias.line, alias.column = n.line, n.column
+
+		return alias, nil
+	case yaml.MappingNode:
+		n.kind = nodeObject
+
+		for i := 0; i+1 < len(y.Content); i += 2 {
+			key, value := y.Content[i], y.Content[i+1]
+
+			valueNode, err := convertYAMLNode(value)
+			if err != nil {
+				return nil, err
+			}
+
+			// Merge keys (<<: *anchor) add the fields of another mapping
+			if key.ShortTag() == "!!merge" {
+				if err := mergeYAMLFields(n, valueNode); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			keyNode := &node{kind: nodeString, line: key.Line, column: key.Column, value: key.Value}
+			n.fields = append(n.fields, nodeField{key.Value, keyNode, valueNode})
+		}
+	case yaml.SequenceNode:
+		n.kind = nodeArray
+
+		for _, item := range y.Content {
+			itemNode, err := convertYAMLNode(item)
+			if err != nil {
+				return nil, err
+			}
+
+			n.items = append(n.items, itemNode)
+		}
+	case yaml.ScalarNode:
+		switch y.ShortTag() {
+		case "!!null":
+			n.kind = nodeNull
+		case "!!bool":
+			var b bool
+			if err := y.Decode(&b); err != nil {
+				return nil, &syntaxError{y.Line, y.Column, err}
+			}
+
+			n.kind = nodeBool
+			n.value = b
+		case "!!int":
+			var i int64
+			if err := y.Decode(&i); err != nil {
+				return nil, &syntaxError{y.Line, y.Column, err}
+			}
+
+			n.kind = nodeNumber
+			n.value = json.Number(strconv.FormatInt(i, 10))
+		case "!!float":
+			var f float64
+			if err := y.Decode(&f); err != nil {
+				return nil, &syntaxError{y.Line, y.Column, err}
+			}
+
+			if math.IsInf(f, 0) || math.IsNaN(f) {
+				return nil, &syntaxError{y.Line, y.Column, fmt.Errorf("unsupported number %s", y.Value)}
+			}
+
+			n.kind = nodeNumber
+			n.value = json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+		default:
+			n.kind = nodeString
+			n.value = y.Value
+		}
+	default:
+		return nil, &syntaxError{y.Line, y.Column, errors.New("unsupported YAML node")}
+	}
+
+	return n, nil
+}
+
+// mergeYAMLFields adds the fields from a merged mapping, or a list of merged
+// mappings, to n, unless n already has them.
+func mergeYAMLFields(n *node, merged *node) error {
+	sources := []*node{merged}
+	if merged.kind == nodeArray {
+		sources = merged.items
+	}
+
+	for _, source := range sources {
+		if source.kind != nodeObject {
+			return &syntaxError{source.line, source.column, errors.New("merge value must be a mapping")}
+		}
+
+		for _, field := range source.fields {
+			if n.at(field.key) == n {
+				n.fields = append(n.fields, field)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jamesbehr/torpedo/tmux"
+)
+
+// SessionInfo describes a running Tmux session.
+type SessionInfo struct {
+	Name string
+	// Attached is whether any clients are showing the session.
+	Attached bool
+	Windows  int
+}
+
+// ListSessions returns the sessions on the Tmux server, or none if the server
+// isn't running.
+func (svc *Service) ListSessions() ([]SessionInfo, error) {
+	listSessions := tmux.ListSessions{
+		// The name is last since it can contain spaces
+		Format: "#{session_attached} #{session_windows} #{session_name}",
+	}
+
+	output, err := svc.tmux.Output(&listSessions)
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("ListSessions: %w", err)
+	}
+
+	sessions := []SessionInfo{}
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(output), "\n"), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		windows, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("ListSessions: invalid window count %q", fields[1])
+		}
+
+		sessions = append(sessions, SessionInfo{
+			Name:     fields[2],
+			Attached: fields[0] != "0",
+			Windows:  windows,
+		})
+	}
+
+	return sessions, nil
+}
+
+// WindowInfo describes a window in a running Tmux session.
+type WindowInfo struct {
+	Index  string
+	Name   string
+	Active bool
+}
+
+// ListWindows returns the windows of a session, in order.
+func (svc *Service) ListWindows(sessionName string) ([]WindowInfo, error) {
+	listWindows := tmux.ListWindows{
+		TargetSession: "=" + sessionName,
+		Format:        "#{window_index} #{window_active} #{window_name}",
+	}
+
+	output, err := svc.tmux.Output(&listWindows)
+	if err != nil {
+		return nil, fmt.Errorf("ListWindows: %w", err)
+	}
+
+	windows := []WindowInfo{}
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(output), "\n"), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		windows = append(windows, WindowInfo{
+			Index:  fields[0],
+			Name:   fields[2],
+			Active: fields[1] == "1",
+		})
+	}
+
+	return windows, nil
+}
+
+// GitStatus returns the files that have changed in the Git repository
+// containing dir, in the short format of git status.
+func GitStatus(dir string) ([]string, error) {
+	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("GitStatus: %w", err)
+	}
+
+	changes := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" {
+			changes = append(changes, line)
+		}
+	}
+
+	return changes, nil
+}
+
+// readmeNames are the names that READMEs are looked for under, in order.
+var readmeNames = []string{"README.md", "README", "README.txt", "README.rst", "README.org", "readme.md"}
+
+// ReadReadme returns the name of the README of the project at projectPath,
+// and up to n of its first lines.
+// The name is empty if the project doesn't have a README.
+func ReadReadme(projectPath string, n int) (string, []string, error) {
+	for _, name := range readmeNames {
+		f, err := os.Open(filepath.Join(projectPath, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return "", nil, fmt.Errorf("ReadReadme: %w", err)
+		}
+
+		defer f.Close()
+
+		lines := []string{}
+		scanner := bufio.NewScanner(f)
+		for len(lines) < n && scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+
+		if err := scanner.Err(); err != nil {
+			return "", nil, fmt.Errorf("ReadReadme: %w", err)
+		}
+
+		return name, lines, nil
+	}
+
+	return "", nil, nil
+}
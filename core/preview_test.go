@@ -0,0 +1,177 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jamesbehr/torpedo/tmux"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTmux returns a client for a script that prints output and exits with
+// status, and the path of the file that the script writes its arguments to.
+func fakeTmux(t *testing.T, output string, status int) (*tmux.Client, string) {
+	dir := t.TempDir()
+	argsPath := filepath.Join(dir, "args")
+	outputPath := filepath.Join(dir, "output")
+
+	require.NoError(t, os.WriteFile(outputPath, []byte(output), 0666))
+
+	script := "#!/bin/sh\n" +
+		"printf '%s\\n' \"$@\" > '" + argsPath + "'\n" +
+		"cat '" + outputPath + "'\n" +
+		"exit " + strconv.Itoa(status) + "\n"
+
+	binaryPath := filepath.Join(dir, "tmux")
+	require.NoError(t, os.WriteFile(binaryPath, []byte(script), 0777))
+
+	return &tmux.Client{BinaryPath: binaryPath}, argsPath
+}
+
+func TestListSessions(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Output   string
+		Status   int
+		Expected []SessionInfo
+		Error    bool
+	}{
+		{
+			Name:   "sessions",
+			Output: "1 3 ~/app\n0 1 my session  with spaces\n2 10 ~/other\n",
+			Expected: []SessionInfo{
+				{Name: "~/app", Attached: true, Windows: 3},
+				{Name: "my session  with spaces", Attached: false, Windows: 1},
+				{Name: "~/other", Attached: true, Windows: 10},
+			},
+		},
+		{
+			Name:     "incomplete lines are skipped",
+			Output:   "1 3\n0 1 app\n",
+			Expected: []SessionInfo{{Name: "app", Windows: 1}},
+		},
+		{
+			Name:     "no sessions",
+			Output:   "",
+			Expected: []SessionInfo{},
+		},
+		{
+			Name:   "server not running",
+			Output: "no server running on /tmp/tmux-1000/default\n",
+			Status: 1,
+		},
+		{
+			Name:   "invalid window count",
+			Output: "1 x app\n",
+			Error:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			client, _ := fakeTmux(t, test.Output, test.Status)
+			svc := Service{tmux: client}
+
+			sessions, err := svc.ListSessions()
+			if test.Error {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, sessions)
+		})
+	}
+}
+
+func TestListWindows(t *testing.T) {
+	client, argsPath := fakeTmux(t, "0 0 editor\n1 1 go test  ./...\n2 0\n10 0 logs\n", 0)
+	svc := Service{tmux: client}
+
+	windows, err := svc.ListWindows("my session")
+	require.NoError(t, err)
+	require.Equal(t, []WindowInfo{
+		{Index: "0", Name: "editor"},
+		{Index: "1", Name: "go test  ./...", Active: true},
+		{Index: "10", Name: "logs"},
+	}, windows)
+
+	args, err := os.ReadFile(argsPath)
+	require.NoError(t, err)
+	require.Contains(t, strings.Split(string(args), "\n"), "=my session")
+
+	client, _ = fakeTmux(t, "can't find session: my session\n", 1)
+	svc = Service{tmux: client}
+
+	_, err = svc.ListWindows("my session")
+	require.Error(t, err)
+}
+
+func TestReadReadme(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Files    map[string]string
+		Lines    int
+		Expected string
+		Content  []string
+	}{
+		{
+			Name:     "no readme",
+			Files:    map[string]string{"main.go": "package main\n"},
+			Lines:    10,
+			Expected: "",
+		},
+		{
+			Name:     "names are tried in order",
+			Files:    map[string]string{"README": "plain\n", "README.md": "# markdown\n", "README.txt": "text\n"},
+			Lines:    10,
+			Expected: "README.md",
+			Content:  []string{"# markdown"},
+		},
+		{
+			Name:     "later names",
+			Files:    map[string]string{"README.org": "* org\n", "readme.md": "lower\n"},
+			Lines:    10,
+			Expected: "README.org",
+			Content:  []string{"* org"},
+		},
+		{
+			Name:     "line limit",
+			Files:    map[string]string{"README": "1\n2\n3\n4\n"},
+			Lines:    2,
+			Expected: "README",
+			Content:  []string{"1", "2"},
+		},
+		{
+			Name:     "fewer lines than the limit",
+			Files:    map[string]string{"README.txt": "1\n\n3"},
+			Lines:    10,
+			Expected: "README.txt",
+			Content:  []string{"1", "", "3"},
+		},
+		{
+			Name:     "empty readme",
+			Files:    map[string]string{"README.md": ""},
+			Lines:    10,
+			Expected: "README.md",
+			Content:  []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.Files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0666))
+			}
+
+			name, lines, err := ReadReadme(dir, test.Lines)
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, name)
+			require.Equal(t, test.Content, lines)
+		})
+	}
+}
@@ -0,0 +1,543 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jamesbehr/torpedo/tmux"
+)
+
+// RunProjectCommand runs the command called name, after running its
+// dependencies.
+// Each command runs at most once, even if several commands depend on it.
+// The args are only passed to the named command, not to its dependencies.
+func (svc *Service) RunProjectCommand(projectPath, shell string, commands map[string]Command, name string, args []string) error {
+	runner := commandRunner{
+		projectPath: projectPath,
+		shell:       shell,
+		commands:    commands,
+		runs:        map[string]*commandRun{},
+	}
+
+	return runner.run(name, args, commandIO{os.Stdin, os.Stdout, os.Stderr})
+}
+
+// killTimeout is how long a command that is being stopped has to exit after
+// SIGTERM, before it is killed.
+const killTimeout = 2 * time.Second
+
+// The places that [Service.RunInSession] can run a command.
+const (
+	RunInWindow = "window"
+	RunInPane   = "pane"
+	RunInPopup  = "popup"
+)
+
+// RunInSession starts command in a new window, pane or popup in a session,
+// without waiting for it to finish.
+// A window is reused if the session already has one called name, killing
+// anything still running in its active pane.
+// Panes are split from the active window of the session.
+// It returns the ID of the pane the command runs in, which is empty for
+// popups since they don't have one.
+func (svc *Service) RunInSession(sessionName, projectPath, in, name string, command []string) (string, error) {
+	var cmd tmux.Command
+
+	switch in {
+	case RunInWindow:
+		listWindows := tmux.ListWindows{
+			TargetSession: "=" + sessionName,
+			Format:        "#{window_name}",
+		}
+
+		output, err := svc.tmux.Output(&listWindows)
+		if err != nil {
+			return "", fmt.Errorf("RunInSession: unable to list windows: %w", err)
+		}
+
+		if slices.Contains(strings.Split(string(output), "\n"), name) {
+			// Respawning the window would make it the current window, so the
+			// active pane in it is respawned instead, and its ID is printed
+			// afterwards since respawn-pane can't print it
+			target := fmt.Sprintf("=%s:=%s.", sessionName, name)
+			cmd = tmux.Multi{
+				&tmux.RespawnPane{
+					TargetPane:     target,
+					StartDirectory: projectPath,
+					Command:        command,
+					Kill:           true,
+				},
+				&tmux.DisplayMessage{
+					TargetPane: target,
+					Print:      true,
+					Message:    "#{pane_id}",
+				},
+			}
+		} else {
+			cmd = &tmux.NewWindow{
+				TargetWindow:   fmt.Sprintf("=%s:", sessionName),
+				WindowName:     name,
+				StartDirectory: projectPath,
+				Command:        command,
+				Detached:       true,
+				PrintFormat:    "#{pane_id}",
+			}
+		}
+	case RunInPane:
+		cmd = &tmux.SplitWindow{
+			TargetPane:     fmt.Sprintf("=%s:", sessionName),
+			StartDirectory: projectPath,
+			Command:        command,
+			Detached:       true,
+			PrintFormat:    "#{pane_id}",
+		}
+	case RunInPopup:
+		if !tmux.InSession() {
+			return "", errors.New("RunInSession: popups can only be shown from inside tmux")
+		}
+
+		quoted := make([]string, len(command))
+		for i, arg := range command {
+			quoted[i] = shellQuote(arg)
+		}
+
+		cmd = &tmux.DisplayPopup{
+			TargetPane:     fmt.Sprintf("=%s:", sessionName),
+			StartDirectory: projectPath,
+			Title:          name,
+			Width:          "80%",
+			Height:         "80%",
+			Command:        strings.Join(quoted, " "),
+		}
+	default:
+		return "", fmt.Errorf("RunInSession: unknown place to run %q", in)
+	}
+
+	output, err := svc.tmux.Output(cmd)
+	if err != nil {
+		return "", fmt.Errorf("RunInSession: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// HoldPane keeps a pane open after its command exits, so that the output can
+// still be read.
+func (svc *Service) HoldPane(targetPane string) error {
+	setOption := tmux.SetOption{
+		Target: targetPane,
+		Pane:   true,
+		Name:   "remain-on-exit",
+		Value:  "on",
+	}
+
+	if err := svc.tmux.Run(&setOption); err != nil {
+		return fmt.Errorf("HoldPane: %w", err)
+	}
+
+	return nil
+}
+
+// commandStatusOption returns the name of the global user option that the
+// status reported on channel is kept in.
+// Keeping it in the Tmux server means only the user can read or change it.
+func commandStatusOption(channel string) string {
+	return "@" + channel
+}
+
+// ReportCommandStatus records the exit status of a command that was started
+// with [Service.RunInSession], and signals anything waiting on channel.
+func (svc *Service) ReportCommandStatus(channel string, status int) error {
+	report := tmux.Multi{
+		&tmux.SetOption{
+			Global: true,
+			Name:   commandStatusOption(channel),
+			Value:  strconv.Itoa(status),
+		},
+		&tmux.WaitFor{Channel: channel, Signal: true},
+	}
+
+	if err := svc.tmux.Run(report); err != nil {
+		return fmt.Errorf("ReportCommandStatus: %w", err)
+	}
+
+	return nil
+}
+
+// commandPaneInterval is how often [Service.WaitForCommandStatus] checks
+// whether the pane of the command has gone.
+const commandPaneInterval = 500 * time.Millisecond
+
+// WaitForCommandStatus waits until [Service.ReportCommandStatus] is called
+// with channel and returns the status.
+// Tmux remembers a signal until something waits for it, so it does not matter
+// whether the command finishes before this is called.
+// If targetPane is set, it is the pane the command runs in, and an error is
+// returned if the pane dies or is killed without the status being reported.
+func (svc *Service) WaitForCommandStatus(channel, targetPane string) (int, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	if targetPane != "" {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			svc.watchCommandPane(ctx, channel, targetPane)
+		}()
+	}
+
+	err := svc.tmux.Run(&tmux.WaitFor{Channel: channel})
+
+	// The watcher is stopped before the status is removed, otherwise it
+	// could see it missing and signal the channel again
+	cancel()
+	wg.Wait()
+
+	if err != nil {
+		return 0, fmt.Errorf("WaitForCommandStatus: %w", err)
+	}
+
+	value, err := svc.commandStatus(channel)
+	if err != nil {
+		return 0, fmt.Errorf("WaitForCommandStatus: %w", err)
+	}
+
+	unset := tmux.SetOption{Global: true, Unset: true, Name: commandStatusOption(channel)}
+	if err := svc.tmux.Run(&unset); err != nil {
+		return 0, fmt.Errorf("WaitForCommandStatus: %w", err)
+	}
+
+	if value == "" {
+		return 0, errors.New("WaitForCommandStatus: the pane closed before the command finished")
+	}
+
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("WaitForCommandStatus: invalid status: %w", err)
+	}
+
+	return status, nil
+}
+
+// commandStatus returns the status reported on channel, or an empty string if
+// none has been reported.
+func (svc *Service) commandStatus(channel string) (string, error) {
+	showOptions := tmux.ShowOptions{
+		Global:    true,
+		Quiet:     true,
+		OnlyValue: true,
+		Name:      commandStatusOption(channel),
+	}
+
+	output, err := svc.tmux.Output(&showOptions)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// watchCommandPane signals channel if targetPane dies or goes away before a
+// status is reported on it, since nothing else would then.
+// It stops when ctx is cancelled.
+func (svc *Service) watchCommandPane(ctx context.Context, channel, targetPane string) {
+	ticker := time.NewTicker(commandPaneInterval)
+	defer ticker.Stop()
+
+	listPanes := tmux.ListPanes{
+		All:    true,
+		Filter: fmt.Sprintf("#{==:#{pane_id},%s}", targetPane),
+		Format: "#{pane_dead}",
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		output, err := svc.tmux.Output(&listPanes)
+		if err != nil {
+			continue
+		}
+
+		// Panes are kept after the command exits, so a dead pane is as good
+		// as a missing one
+		if dead := strings.TrimSpace(string(output)); dead == "0" {
+			continue
+		}
+
+		// The command reports its status before it exits, so if there is
+		// none now there never will be
+		if status, err := svc.commandStatus(channel); err != nil || status != "" {
+			return
+		}
+
+		svc.tmux.Run(&tmux.WaitFor{Channel: channel, Signal: true})
+
+		return
+	}
+}
+
+type commandIO struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type commandRunner struct {
+	projectPath string
+	shell       string
+	commands    map[string]Command
+
+	// If ctx is set, each command runs in its own process group, which is
+	// killed when ctx is cancelled
+	ctx context.Context
+
+	// outputMu stops the output of parallel commands from being interleaved
+	// in the middle of a line
+	outputMu sync.Mutex
+
+	mu   sync.Mutex
+	runs map[string]*commandRun
+}
+
+// commandRun is the result of a command, which is ready once done is closed.
+type commandRun struct {
+	done chan struct{}
+	err  error
+}
+
+// run runs a command, or waits for it to finish if it has already been
+// started.
+func (r *commandRunner) run(name string, args []string, stdio commandIO) error {
+	r.mu.Lock()
+
+	if run, ok := r.runs[name]; ok {
+		r.mu.Unlock()
+		<-run.done
+		return run.err
+	}
+
+	run := &commandRun{done: make(chan struct{})}
+	r.runs[name] = run
+	r.mu.Unlock()
+
+	run.err = r.runCommand(name, args, stdio)
+	close(run.done)
+
+	return run.err
+}
+
+func (r *commandRunner) runCommand(name string, args []string, stdio commandIO) error {
+	command, ok := r.commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	if err := r.runDeps(command, stdio); err != nil {
+		return err
+	}
+
+	if command.Run == "" {
+		return nil
+	}
+
+	cmd := projectScriptCommand(r.projectPath, r.shell, command, args)
+	cmd.Stdin = stdio.stdin
+	cmd.Stdout = stdio.stdout
+	cmd.Stderr = stdio.stderr
+
+	if r.ctx == nil {
+		return cmd.Run()
+	}
+
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+
+	// Killing the shell alone would leave the processes that the script
+	// started running
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	defer close(exited)
+
+	stop := context.AfterFunc(r.ctx, func() {
+		terminateProcessGroup(cmd)
+
+		// Commands that ignore or trap SIGTERM would otherwise keep
+		// running, and the command could never be restarted
+		select {
+		case <-exited:
+		case <-time.After(killTimeout):
+			killProcessGroup(cmd)
+		}
+	})
+	defer stop()
+
+	return cmd.Wait()
+}
+
+func (r *commandRunner) runDeps(command Command, stdio commandIO) error {
+	if !command.Parallel {
+		for _, dep := range command.Deps {
+			if err := r.run(dep, nil, stdio); err != nil {
+				return fmt.Errorf("dependency %q failed: %w", dep, err)
+			}
+		}
+
+		return nil
+	}
+
+	errs := make([]error, len(command.Deps))
+
+	var wg sync.WaitGroup
+
+	for i, dep := range command.Deps {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// Parallel commands can't share stdin, and their output is
+			// prefixed so it can be told apart
+			prefix := fmt.Sprintf("[%s] ", dep)
+			stdout := &prefixWriter{w: stdio.stdout, mu: &r.outputMu, prefix: prefix}
+			stderr := &prefixWriter{w: stdio.stderr, mu: &r.outputMu, prefix: prefix}
+
+			if err := r.run(dep, nil, commandIO{nil, stdout, stderr}); err != nil {
+				errs[i] = fmt.Errorf("dependency %q failed: %w", dep, err)
+			}
+
+			stdout.Flush()
+			stderr.Flush()
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// prefixWriter writes each line written to it to w with a prefix.
+// Lines are written whole, with mu held.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := pw.writeLine(pw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+
+		pw.buf = pw.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush writes any incomplete line that is left, followed by a newline.
+func (pw *prefixWriter) Flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+
+	line := append(pw.buf, '\n')
+	pw.buf = nil
+
+	return pw.writeLine(line)
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	_, err := io.WriteString(pw.w, pw.prefix+string(line))
+	return err
+}
+
+// commandCycle returns the chain of dependencies that leads from the command
+// called name back to itself, or nil if there is none.
+func commandCycle(commands map[string]Command, name string) []string {
+	visited := map[string]bool{}
+
+	var visit func(current string, path []string) []string
+	visit = func(current string, path []string) []string {
+		for _, dep := range commands[current].Deps {
+			next := append(slices.Clone(path), dep)
+			if dep == name {
+				return next
+			}
+
+			if visited[dep] {
+				continue
+			}
+
+			visited[dep] = true
+
+			if cycle := visit(dep, next); cycle != nil {
+				return cycle
+			}
+		}
+
+		return nil
+	}
+
+	return visit(name, []string{name})
+}
+
+// projectScriptCommand returns the command that runs the script of a command
+// with args, using its shell if it has one or else shell, which is the
+// user's shell.
+// It runs in the command's directory, with its environment added to this
+// process's.
+func projectScriptCommand(projectPath string, shell string, command Command, args []string) *exec.Cmd {
+	if command.Shell != "" {
+		shell = command.Shell
+	}
+
+	script := command.Run
+
+	// Let the shell do the parameter escaping
+	for i := range args {
+		script += fmt.Sprintf(" \"$%d\"", i+1)
+	}
+
+	shellArgs := []string{"-c", script, "torpedo"}
+	shellArgs = append(shellArgs, args...)
+
+	cmd := exec.Command(shell, shellArgs...)
+	cmd.Dir = command.Dir(projectPath)
+	cmd.Env = append(os.Environ(), command.Env...)
+
+	return cmd
+}
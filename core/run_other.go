@@ -0,0 +1,19 @@
+//go:build !unix
+
+package core
+
+import "os/exec"
+
+// setProcessGroup does nothing, since process groups are only used on Unix.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcessGroup kills just the command, since there is no SIGTERM,
+// so the processes that it started are left running.
+func terminateProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// killProcessGroup kills just the command.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
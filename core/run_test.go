@@ -0,0 +1,293 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamesbehr/torpedo/tmux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectScriptCommand(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0777))
+
+	tests := []struct {
+		Name     string
+		Command  Command
+		Args     []string
+		Expected string
+	}{
+		{
+			Name:     "project root",
+			Command:  Command{Run: "pwd"},
+			Expected: dir + "\n",
+		},
+		{
+			Name:     "cwd",
+			Command:  Command{Run: "pwd", Cwd: "sub"},
+			Expected: filepath.Join(dir, "sub") + "\n",
+		},
+		{
+			Name:     "cwd outside project",
+			Command:  Command{Run: "pwd", Cwd: "../.."},
+			Expected: dir + "\n",
+		},
+		{
+			Name:     "args",
+			Command:  Command{Run: "printf '%s\\n'"},
+			Args:     []string{"a b", "$c"},
+			Expected: "a b\n$c\n",
+		},
+		{
+			Name:     "env",
+			Command:  Command{Run: "echo $FOO", Env: []string{"FOO=a b"}},
+			Expected: "a b\n",
+		},
+		{
+			Name:     "shell",
+			Command:  Command{Run: "echo $0", Shell: "sh"},
+			Expected: "torpedo\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			// The user's shell is only used if the command doesn't have its
+			// own, so it doesn't exist for commands that do
+			shell := "sh"
+			if test.Command.Shell != "" {
+				shell = "/nonexistent/shell"
+			}
+
+			output, err := projectScriptCommand(dir, shell, test.Command, test.Args).Output()
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, string(output))
+		})
+	}
+}
+
+func TestCommandRunner(t *testing.T) {
+	commands := map[string]Command{
+		"gen":     {Run: "echo gen"},
+		"build":   {Run: "echo build", Deps: []string{"gen"}},
+		"test":    {Run: "echo test $FOO", Env: []string{"FOO=bar"}, Deps: []string{"gen", "build"}},
+		"lint":    {Run: "echo lint >&2"},
+		"check":   {Deps: []string{"lint", "test"}, Parallel: true},
+		"partial": {Run: "printf partial"},
+		"slow":    {Deps: []string{"partial"}, Parallel: true},
+		"fail":    {Run: "exit 3"},
+		"broken":  {Run: "echo unreachable", Deps: []string{"fail"}},
+	}
+
+	tests := []struct {
+		Name     string
+		Command  string
+		Expected []string
+		Error    string
+	}{
+		{
+			Name:     "deps run once",
+			Command:  "test",
+			Expected: []string{"gen", "build", "test bar"},
+		},
+		{
+			Name:     "parallel",
+			Command:  "check",
+			Expected: []string{"[lint] lint", "[test] build", "[test] gen", "[test] test bar"},
+		},
+		{
+			Name:     "incomplete line",
+			Command:  "slow",
+			Expected: []string{"[partial] partial"},
+		},
+		{
+			Name:    "failed dependency",
+			Command: "broken",
+			Error:   `dependency "fail" failed: exit status 3`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var stdout bytes.Buffer
+
+			runner := commandRunner{
+				projectPath: t.TempDir(),
+				shell:       "sh",
+				commands:    commands,
+				runs:        map[string]*commandRun{},
+			}
+
+			err := runner.run(test.Command, nil, commandIO{nil, &stdout, &stdout})
+			if test.Error != "" {
+				require.EqualError(t, err, test.Error)
+				require.Empty(t, stdout.String())
+				return
+			}
+
+			require.NoError(t, err)
+
+			lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+
+			// The order of parallel output is not deterministic
+			if commands[test.Command].Parallel {
+				slices.Sort(lines)
+			}
+
+			require.Equal(t, test.Expected, lines)
+		})
+	}
+}
+
+func TestCommandCycle(t *testing.T) {
+	commands := map[string]Command{
+		"a": {Deps: []string{"b"}},
+		"b": {Deps: []string{"c", "a"}},
+		"c": {Run: "true"},
+		"d": {Deps: []string{"a"}},
+	}
+
+	require.Equal(t, []string{"a", "b", "a"}, commandCycle(commands, "a"))
+	require.Equal(t, []string{"b", "a", "b"}, commandCycle(commands, "b"))
+	require.Nil(t, commandCycle(commands, "c"))
+	require.Nil(t, commandCycle(commands, "d"))
+}
+
+func TestStopCommand(t *testing.T) {
+	dir := t.TempDir()
+	started := filepath.Join(dir, "started")
+
+	commands := map[string]Command{
+		// The script and the sleep both ignore SIGTERM
+		"stubborn": {Run: "trap '' TERM; touch " + started + "; sleep 30"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := commandRunner{
+		projectPath: dir,
+		shell:       "sh",
+		commands:    commands,
+		ctx:         ctx,
+		runs:        map[string]*commandRun{},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runner.run("stubborn", nil, commandIO{})
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(started)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err := <-done:
+		require.Error(t, err)
+	case <-time.After(killTimeout + 5*time.Second):
+		t.Fatal("the command was not killed")
+	}
+}
+
+func TestRunInSession(t *testing.T) {
+	client := tmux.Client{
+		SocketPath: filepath.Join(t.TempDir(), "tmux"),
+		Config:     "testdata/tmux/config/base.conf",
+	}
+
+	defer func() {
+		if err := client.Run(&tmux.KillServer{}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	svc := Service{tmux: &client}
+	dir := t.TempDir()
+
+	// Creating the session starts the server, which would exit straight away
+	// if it was started without one
+	require.NoError(t, svc.CreateSession("proj", dir, nil, []Window{{Name: "editor"}}))
+
+	sleep := []string{"sleep", "60"}
+
+	listWindows := func() string {
+		output, err := client.Output(&tmux.ListWindows{
+			TargetSession: "=proj",
+			Format:        "#{window_name} #{window_active} #{window_panes}",
+		})
+		require.NoError(t, err)
+
+		return string(output)
+	}
+
+	pane, err := svc.RunInSession("proj", dir, RunInWindow, "test", sleep)
+	require.NoError(t, err)
+	require.Regexp(t, `^%\d+$`, pane)
+	require.Equal(t, "editor 1 1\ntest 0 1\n", listWindows())
+
+	// The window is reused rather than creating another one
+	respawned, err := svc.RunInSession("proj", dir, RunInWindow, "test", sleep)
+	require.NoError(t, err)
+	require.Equal(t, pane, respawned)
+	require.Equal(t, "editor 1 1\ntest 0 1\n", listWindows())
+
+	split, err := svc.RunInSession("proj", dir, RunInPane, "test", sleep)
+	require.NoError(t, err)
+	require.NotEqual(t, pane, split)
+	require.Equal(t, "editor 1 2\ntest 0 1\n", listWindows())
+
+	_, err = svc.RunInSession("proj", dir, "tab", "test", sleep)
+	require.Error(t, err)
+}
+
+func TestCommandStatus(t *testing.T) {
+	client := tmux.Client{
+		SocketPath: filepath.Join(t.TempDir(), "tmux"),
+		Config:     "testdata/tmux/config/base.conf",
+	}
+
+	defer func() {
+		if err := client.Run(&tmux.KillServer{}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	svc := Service{tmux: &client}
+	channel := strings.ReplaceAll(t.Name(), "/", "-")
+
+	// Creating the session starts the server, which would exit straight away
+	// if it was started without one
+	require.NoError(t, svc.CreateSession("proj", t.TempDir(), nil, nil))
+
+	// Reporting first checks that the signal isn't lost if nothing is
+	// waiting yet
+	require.NoError(t, svc.ReportCommandStatus(channel, 3))
+
+	status, err := svc.WaitForCommandStatus(channel, "")
+	require.NoError(t, err)
+	require.Equal(t, 3, status)
+
+	value, err := svc.commandStatus(channel)
+	require.NoError(t, err)
+	require.Empty(t, value)
+
+	// A pane that is killed before the command reports its status doesn't
+	// leave anything waiting forever
+	pane, err := svc.RunInSession("proj", t.TempDir(), RunInWindow, "test", []string{"sleep", "60"})
+	require.NoError(t, err)
+	require.NoError(t, client.Run(&tmux.KillWindow{TargetWindow: "=proj:=test"}))
+
+	_, err = svc.WaitForCommandStatus(channel, pane)
+	require.Error(t, err)
+}
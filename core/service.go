@@ -2,27 +2,31 @@ package core
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
+	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jamesbehr/torpedo/tmux"
 )
 
 type Service struct {
 	tmux *tmux.Client
+	// configDir is the directory containing the user's config files.
+	configDir string
 }
 
-func New() *Service {
+// New creates a service that reads the user's config files from configDir.
+func New(configDir string) *Service {
 	return &Service{
-		tmux: &tmux.Client{},
+		tmux:      &tmux.Client{},
+		configDir: configDir,
 	}
 }
 
@@ -40,11 +44,17 @@ var ErrProjectNotFound = errors.New("could not find project root")
 // immediate parent of that directory.
 // If no such directory is found, it will return an [ErrProjectNotFound] error
 func (svc *Service) FindCurrentProject(currentDirectory string) (string, error) {
+	// A relative path has to be made absolute to be able to find its parents
+	currentDirectory, err := filepath.Abs(currentDirectory)
+	if err != nil {
+		return "", err
+	}
+
 	for i := 0; i < maxParents; i++ {
 		dataDir := filepath.Join(currentDirectory, projectDataDir)
 		if info, err := os.Stat(dataDir); err == nil {
 			if info.IsDir() {
-				return filepath.Abs(currentDirectory)
+				return currentDirectory, nil
 			}
 		} else if !os.IsNotExist(err) {
 			return "", err
@@ -175,22 +185,48 @@ func (svc *Service) FindProjects(paths []string) ([]string, error) {
 }
 
 func (svc *Service) AttachSession(sessionName string) error {
+	if err := svc.attach(sessionName); err != nil {
+		return fmt.Errorf("AttachSession: %w", err)
+	}
+
+	return nil
+}
+
+// AttachWindow attaches to a session like [Service.AttachSession], showing
+// the window at windowIndex.
+// The current window belongs to the session in Tmux, so it also changes for
+// the other clients that are showing the session.
+func (svc *Service) AttachWindow(sessionName, windowIndex string) error {
+	if err := svc.attach("=" + sessionName + ":" + windowIndex); err != nil {
+		return fmt.Errorf("AttachWindow: %w", err)
+	}
+
+	return nil
+}
+
+// attach switches the client to target inside Tmux, or attaches to it
+// outside of Tmux.
+func (svc *Service) attach(target string) error {
 	if tmux.InSession() {
 		switchClient := tmux.SwitchClient{
-			SessionName: sessionName,
+			SessionName: target,
 		}
 
 		if err := svc.tmux.Run(&switchClient); err != nil {
-			return fmt.Errorf("AttachSession: unable to switch client: %w", err)
+			return fmt.Errorf("unable to switch client: %w", err)
 		}
+
+		// Attaching would fail when run from a key binding, since there is
+		// no terminal
+		return nil
 	}
 
 	attachSession := tmux.AttachSession{
-		SessionName: sessionName,
+		SessionName: target,
 	}
 
 	if err := svc.tmux.Run(&attachSession); err != nil {
-		return fmt.Errorf("AttachSession: unable to attach to session: %w", err)
+		return fmt.Errorf("unable to attach to session: %w", err)
 	}
 
 	return nil
@@ -358,9 +394,34 @@ func (svc *Service) DumpSession(sessionName string) ([]Window, error) {
 	return windows, nil
 }
 
+// CurrentSession returns the name of the tmux session that torpedo is running
+// in.
+func (svc *Service) CurrentSession() (string, error) {
+	if !tmux.InSession() {
+		return "", errors.New("CurrentSession: not running inside tmux")
+	}
+
+	// Commands run by key bindings aren't in a pane, so the session of the
+	// client that ran them is used instead
+	displayMessage := tmux.DisplayMessage{
+		TargetPane: os.Getenv("TMUX_PANE"),
+		Print:      true,
+		Message:    "#{session_name}",
+	}
+
+	output, err := svc.tmux.Output(&displayMessage)
+	if err != nil {
+		return "", fmt.Errorf("CurrentSession: %w", err)
+	}
+
+	return strings.TrimSuffix(string(output), "\n"), nil
+}
+
 func (svc *Service) HasSession(sessionName string) (bool, error) {
+	// Tmux falls back to matching a prefix of the session name, which would
+	// find the session for a layout profile when looking for the project
 	hasSession := tmux.HasSession{
-		SessionName: sessionName,
+		SessionName: "=" + sessionName,
 	}
 
 	ok, err := svc.tmux.Success(&hasSession)
@@ -371,7 +432,43 @@ func (svc *Service) HasSession(sessionName string) (bool, error) {
 	return ok, err
 }
 
-func (svc *Service) CreateSession(sessionName, projectPath string, windows []Window) error {
+func (svc *Service) CreateSession(sessionName, projectPath string, session *Session, windows []Window) error {
+	paneBaseIndex, err := svc.paneBaseIndex()
+	if err != nil {
+		return fmt.Errorf("CreateSession: unable to read pane-base-index: %w", err)
+	}
+
+	cmds, err := sessionCommands(sessionName, projectPath, session, windows, paneBaseIndex)
+	if err != nil {
+		return fmt.Errorf("CreateSession: %w", err)
+	}
+
+	if err := svc.tmux.Run(tmux.Multi(cmds)); err != nil {
+		return fmt.Errorf("CreateSession: unable to create session: %w", err)
+	}
+
+	return nil
+}
+
+// paneBaseIndex returns the index of the first pane in a window, which is set
+// by the pane-base-index option.
+// It starts the server if it isn't running, so that the option is read from
+// the tmux config.
+func (svc *Service) paneBaseIndex() (int, error) {
+	output, err := svc.tmux.Output(tmux.Multi{
+		&tmux.StartServer{},
+		&tmux.ShowOptions{Global: true, OnlyValue: true, Name: "pane-base-index"},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
+// sessionCommands returns the commands that create a session with its
+// options, environment, hooks and windows.
+func sessionCommands(sessionName, projectPath string, session *Session, windows []Window, paneBaseIndex int) ([]tmux.Command, error) {
 	cmds := []tmux.Command{}
 
 	newSession := tmux.NewSession{
@@ -382,34 +479,121 @@ func (svc *Service) CreateSession(sessionName, projectPath string, windows []Win
 
 	cmds = append(cmds, &newSession)
 
+	// The session environment is only inherited by panes created after it is
+	// set, so the first pane needs it passed explicitly
+	sessionEnv := []string{}
+
+	if session != nil {
+		for _, name := range sortedKeys(session.Environment) {
+			value := session.Environment[name]
+			sessionEnv = append(sessionEnv, name+"="+value)
+
+			cmds = append(cmds, &tmux.SetEnvironment{
+				TargetSession: sessionName,
+				Name:          name,
+				Value:         value,
+			})
+		}
+
+		for _, name := range sortedKeys(session.Options) {
+			cmds = append(cmds, &tmux.SetOption{
+				Target: sessionName,
+				Name:   name,
+				Value:  session.Options[name],
+			})
+		}
+
+		for _, name := range sortedKeys(session.Hooks) {
+			cmds = append(cmds, &tmux.SetHook{
+				TargetSession: sessionName,
+				Name:          name,
+				Command:       session.Hooks[name],
+			})
+		}
+	}
+
+	newSession.Environment = sessionEnv
+
+	windowCmds, activeWindow, err := createWindows(sessionName, projectPath, windows, paneBaseIndex, &newSession)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds = append(cmds, windowCmds...)
+	cmds = append(cmds, selectWindowCommands(sessionName, activeWindow)...)
+
+	return cmds, nil
+}
+
+// ReplaceWindows replaces every window in an existing session with windows.
+// The new windows are created before the old ones are killed, so that the
+// session is never left without a window.
+func (svc *Service) ReplaceWindows(sessionName, projectPath string, windows []Window) error {
+	// Killing the old windows without creating any would end the session
+	if len(windows) == 0 {
+		return errors.New("ReplaceWindows: there are no windows to replace the session's windows with")
+	}
+
+	listWindows := tmux.ListWindows{
+		TargetSession: "=" + sessionName,
+		Format:        "#{window_id}",
+	}
+
+	output, err := svc.tmux.Output(&listWindows)
+	if err != nil {
+		return fmt.Errorf("ReplaceWindows: unable to list windows: %w", err)
+	}
+
+	paneBaseIndex, err := svc.paneBaseIndex()
+	if err != nil {
+		return fmt.Errorf("ReplaceWindows: unable to read pane-base-index: %w", err)
+	}
+
+	cmds, activeWindow, err := createWindows(sessionName, projectPath, windows, paneBaseIndex, nil)
+	if err != nil {
+		return fmt.Errorf("ReplaceWindows: %w", err)
+	}
+
+	for _, id := range strings.Fields(string(output)) {
+		cmds = append(cmds, &tmux.KillWindow{TargetWindow: id})
+	}
+
+	cmds = append(cmds, selectWindowCommands(sessionName, activeWindow)...)
+
+	if err := svc.tmux.Run(tmux.Multi(cmds)); err != nil {
+		return fmt.Errorf("ReplaceWindows: unable to replace windows: %w", err)
+	}
+
+	return nil
+}
+
+// createWindows returns the commands that create windows in a session.
+// If newSession is not nil, the first window is created by it, otherwise every
+// window is created with new-window.
+// It also returns the index of the active window, or -1 if there is none.
+func createWindows(sessionName, projectPath string, windows []Window, paneBaseIndex int, newSession *tmux.NewSession) ([]tmux.Command, int, error) {
+	cmds := []tmux.Command{}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, -1, err
+	}
+
 	activeWindow := -1
 
 	for wi, window := range windows {
-		activePane := -1
-
 		if window.Active {
 			activeWindow = wi
 		}
 
-		if wi == 0 {
+		if wi == 0 && newSession != nil {
 			newSession.WindowName = window.Name
 
-			for pi, pane := range window.Panes {
-				if pi == 0 {
-					newSession.StartDirectory = pane.StartDirectory(projectPath)
-					newSession.Environment = pane.Env
-					newSession.Command = pane.Cmd
-				} else {
-					cmds = append(cmds, &tmux.SplitWindow{
-						StartDirectory: pane.StartDirectory(projectPath),
-						Environment:    pane.Env,
-						Command:        pane.Cmd,
-					})
-				}
-
-				if pane.Active {
-					activePane = pi
-				}
+			if len(window.Panes) > 0 {
+				pane := window.Panes[0]
+				newSession.StartDirectory = pane.StartDirectory(projectPath)
+				newSession.Environment = append(newSession.Environment, pane.Env...)
+				newSession.Command = pane.Cmd
 			}
 		} else {
 			newWindow := tmux.NewWindow{
@@ -417,121 +601,303 @@ func (svc *Service) CreateSession(sessionName, projectPath string, windows []Win
 				TargetWindow: fmt.Sprintf("%s:", sessionName),
 			}
 
+			if len(window.Panes) > 0 {
+				pane := window.Panes[0]
+				newWindow.StartDirectory = pane.StartDirectory(projectPath)
+				newWindow.Environment = pane.Env
+				newWindow.Command = pane.Cmd
+			}
+
 			cmds = append(cmds, &newWindow)
+		}
 
-			for pi, pane := range window.Panes {
-				if pi == 0 {
-					newWindow.StartDirectory = pane.StartDirectory(projectPath)
-					newWindow.Environment = pane.Env
-					newWindow.Command = pane.Cmd
-				} else {
-					cmds = append(cmds, &tmux.SplitWindow{
-						StartDirectory: pane.StartDirectory(projectPath),
-						Environment:    pane.Env,
-						Command:        pane.Cmd,
-					})
-				}
+		windowCmds, err := windowCommands(projectPath, executable, window, paneBaseIndex)
+		if err != nil {
+			return nil, -1, err
+		}
 
-				if pane.Active {
-					activePane = pi
-				}
-			}
+		cmds = append(cmds, windowCmds...)
+	}
+
+	return cmds, activeWindow, nil
+}
+
+// selectWindowCommands returns the commands that select the window at index
+// in a session, if there is one.
+// The window index depends on the base-index option, so the window is selected
+// by its offset from the first window instead.
+func selectWindowCommands(sessionName string, index int) []tmux.Command {
+	if index < 0 {
+		return nil
+	}
+
+	cmds := []tmux.Command{
+		&tmux.SelectWindow{TargetWindow: fmt.Sprintf("%s:^", sessionName)},
+	}
+
+	if index > 0 {
+		cmds = append(cmds, &tmux.SelectWindow{
+			TargetWindow: fmt.Sprintf("%s:+%d", sessionName, index),
+		})
+	}
+
+	return cmds
+}
+
+// windowCommands returns the commands that create every pane after the first
+// one in window and then set them up, assuming that the window has just been
+// created with the first pane.
+// The executable is used to run commands that wait before sending keys to a
+// pane.
+// Tmux numbers panes by their position in the window, starting from
+// paneBaseIndex, so splitting a pane shifts the index of every pane after it.
+// To target panes by index, it keeps track of which pane in window.Panes is
+// at each position.
+func windowCommands(projectPath, executable string, window Window, paneBaseIndex int) ([]tmux.Command, error) {
+	cmds := []tmux.Command{}
+
+	if len(window.Panes) == 0 {
+		return cmds, nil
+	}
+
+	positions := []int{0}
+	current := 0
+
+	for pi := 1; pi < len(window.Panes); pi++ {
+		pane := window.Panes[pi]
+
+		splitWindow := tmux.SplitWindow{
+			StartDirectory: pane.StartDirectory(projectPath),
+			Environment:    pane.Env,
+			Command:        pane.Cmd,
+			Size:           pane.Size,
 		}
 
-		if window.Layout != "" {
-			cmds = append(cmds, &tmux.SelectLayout{
-				LayoutName: window.Layout,
-			})
+		switch pane.Split {
+		case "":
+		case SplitHorizontal:
+			splitWindow.Horizontal = true
+		case SplitVertical:
+			splitWindow.Vertical = true
+		default:
+			return nil, fmt.Errorf("invalid split direction %q", pane.Split)
 		}
 
-		if activePane >= 0 {
-			cmds = append(cmds, &tmux.SelectPane{
-				TargetPane: strconv.Itoa(activePane),
+		if pane.Target != "" {
+			target := slices.IndexFunc(positions, func(i int) bool {
+				return window.Panes[i].Name == pane.Target
 			})
+
+			if target < 0 {
+				return nil, fmt.Errorf("no pane named %q before pane %d in window %q", pane.Target, pi, window.Name)
+			}
+
+			splitWindow.TargetPane = strconv.Itoa(paneBaseIndex + target)
+			current = target
 		}
+
+		cmds = append(cmds, &splitWindow)
+
+		// The new pane is placed after the pane that was split and becomes the
+		// current pane
+		current++
+		positions = slices.Insert(positions, current, pi)
 	}
 
-	if activeWindow >= 0 {
-		cmds = append(cmds, &tmux.SelectWindow{
-			TargetWindow: strconv.Itoa(activeWindow),
+	if window.Layout != "" {
+		cmds = append(cmds, &tmux.SelectLayout{
+			LayoutName: window.Layout,
 		})
 	}
 
-	if err := svc.tmux.Run(tmux.Multi(cmds)); err != nil {
-		return fmt.Errorf("CreateSession: unable to create session: %w", err)
+	for position, pi := range positions {
+		pane := window.Panes[pi]
+		target := strconv.Itoa(paneBaseIndex + position)
+
+		if pane.Title != "" {
+			cmds = append(cmds, &tmux.SelectPane{
+				TargetPane: target,
+				Title:      pane.Title,
+			})
+		}
+
+		if pane.Role != "" {
+			cmds = append(cmds, &tmux.SetOption{
+				Target: target,
+				Pane:   true,
+				Name:   roleOption,
+				Value:  pane.Role,
+			})
+		}
+
+		if len(pane.SendKeys) == 0 {
+			continue
+		}
+
+		if pane.WaitFor == nil {
+			cmds = append(cmds, sendLines(target, pane.SendKeys)...)
+			continue
+		}
+
+		// Waiting happens in the background so creating the session does not
+		// block. The pane ID is filled in by tmux, since the pane index may
+		// change by the time the keys are sent.
+		args := []string{executable, "wait-for"}
+		if pane.WaitFor.File != "" {
+			args = append(args, "--file", pane.WaitFor.Path(projectPath))
+		}
+
+		if pane.WaitFor.TCP != "" {
+			args = append(args, "--tcp", pane.WaitFor.Address())
+		}
+
+		args = append(args, "--")
+		args = append(args, pane.SendKeys...)
+
+		command := []string{}
+		for _, arg := range args {
+			command = append(command, shellQuote(strings.ReplaceAll(arg, "#", "##")))
+		}
+
+		command = slices.Insert(command, 2, "--target", "'#{pane_id}'")
+
+		cmds = append(cmds, &tmux.RunShell{
+			TargetPane: target,
+			Background: true,
+			Command:    strings.Join(command, " "),
+		})
 	}
 
-	return nil
-}
+	activePane := -1
+	zoomedPane := -1
 
-func (svc *Service) ParseProjectConfig(projectPath string) (*Config, error) {
-	configPath := filepath.Join(projectPath, projectDataDir, "config.json")
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, err
+	for position, pi := range positions {
+		if window.Panes[pi].Active && (activePane < 0 || pi > positions[activePane]) {
+			activePane = position
+		}
+
+		if window.Panes[pi].Zoom && (zoomedPane < 0 || pi > positions[zoomedPane]) {
+			zoomedPane = position
+		}
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+	if activePane >= 0 {
+		cmds = append(cmds, &tmux.SelectPane{
+			TargetPane: strconv.Itoa(paneBaseIndex + activePane),
+		})
 	}
 
-	return &cfg, nil
+	if zoomedPane >= 0 {
+		cmds = append(cmds, &tmux.ResizePane{
+			TargetPane: strconv.Itoa(paneBaseIndex + zoomedPane),
+			Zoom:       true,
+		})
+	}
+
+	return cmds, nil
 }
 
-func (svc *Service) RunProjectScript(projectPath string, shell, script string, args []string) error {
-	// Let the shell do the parameter escaping
-	for i := range args {
-		script += fmt.Sprintf(" \"$%d\"", i+1)
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
 
-	shellArgs := []string{"-c", script, "torpedo"}
-	shellArgs = append(shellArgs, args...)
+	slices.Sort(keys)
 
-	cmd := exec.Command(shell, shellArgs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	return cmd.Run()
+	return keys
 }
 
-func (svc *Service) ProjectDataFilePath(projectPath string, filename string) string {
-	return filepath.Join(projectPath, projectDataDir, filename)
-}
+// sendLines returns the commands to type each line into the target pane,
+// followed by the Enter key.
+func sendLines(targetPane string, lines []string) []tmux.Command {
+	cmds := []tmux.Command{}
+
+	for _, line := range lines {
+		cmds = append(cmds, &tmux.SendKeys{
+			TargetPane: targetPane,
+			Literal:    true,
+			Keys:       []string{line},
+		}, &tmux.SendKeys{
+			TargetPane: targetPane,
+			Keys:       []string{"Enter"},
+		})
+	}
 
-type Config struct {
-	Commands map[string]string `json:"commands,omitempty"`
-	Windows  []Window          `json:"windows,omitempty"`
+	return cmds
 }
 
-type Pane struct {
-	Pwd    string   `json:"pwd,omitempty"`
-	Env    []string `json:"env,omitempty"`
-	Cmd    []string `json:"cmd,omitempty"`
-	Active bool     `json:"active,omitempty"`
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
 
-func (p *Pane) StartDirectory(projectDir string) string {
-	if filepath.IsLocal(p.Pwd) {
-		return filepath.Join(projectDir, p.Pwd)
+// SendLines types each line into the target pane, pressing Enter after each
+// one.
+func (svc *Service) SendLines(targetPane string, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if err := svc.tmux.Run(tmux.Multi(sendLines(targetPane, lines))); err != nil {
+		return fmt.Errorf("SendLines: %w", err)
 	}
 
-	return projectDir
+	return nil
 }
 
-type Window struct {
-	Name   string `json:"name,omitempty"`
-	Layout string `json:"layout,omitempty"`
-	Panes  []Pane `json:"panes,omitempty"`
-	Active bool   `json:"active,omitempty"`
+// ShowMessage shows message in the status line of the clients that are
+// showing targetPane, until a key is pressed.
+func (svc *Service) ShowMessage(targetPane, message string) error {
+	displayMessage := tmux.DisplayMessage{
+		TargetPane: targetPane,
+		Hold:       true,
+		Message:    strings.ReplaceAll(message, "#", "##"),
+	}
+
+	if err := svc.tmux.Run(&displayMessage); err != nil {
+		return fmt.Errorf("ShowMessage: %w", err)
+	}
+
+	return nil
 }
 
-func cleanMarkLine(line string) string {
-	commentStart := strings.IndexRune(line, '#')
-	if commentStart >= 0 {
-		line = line[:commentStart]
+// WaitFor blocks until all the files exist and a TCP connection can be made
+// to all the addresses.
+// It returns an error if this does not happen before the timeout.
+func (svc *Service) WaitFor(files, addresses []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		ready := true
+
+		for _, file := range files {
+			if _, err := os.Stat(file); err != nil {
+				ready = false
+			}
+		}
+
+		for _, address := range addresses {
+			conn, err := net.DialTimeout("tcp", address, time.Second)
+			if err != nil {
+				ready = false
+				continue
+			}
+
+			conn.Close()
+		}
+
+		if ready {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("WaitFor: timed out after %s", timeout)
+		}
+
+		time.Sleep(250 * time.Millisecond)
 	}
+}
 
-	return strings.TrimSpace(line)
+func (svc *Service) ProjectDataFilePath(projectPath string, filename string) string {
+	return filepath.Join(projectPath, projectDataDir, filename)
 }
@@ -1,8 +1,10 @@
 package core
 
 import (
+	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/jamesbehr/torpedo/tmux"
@@ -93,9 +95,9 @@ func TestCreateSession(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			svc := Service{&client}
+			svc := Service{tmux: &client}
 
-			if err := svc.CreateSession(t.Name(), test.ProjectDir, test.Given); err != nil {
+			if err := svc.CreateSession(t.Name(), test.ProjectDir, nil, test.Given); err != nil {
 				t.Fatal(err)
 			}
 
@@ -108,3 +110,221 @@ func TestCreateSession(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateSessionPaneBaseIndex(t *testing.T) {
+	client := tmux.Client{
+		SocketPath: filepath.Join(t.TempDir(), "tmux"),
+		Config:     "testdata/tmux/config/pane-base-index.conf",
+	}
+
+	svc := Service{tmux: &client}
+
+	windows := []Window{
+		{
+			Panes: []Pane{
+				{Name: "top", Title: "top"},
+				{Title: "bottom", Split: SplitVertical},
+				{Title: "right", Target: "top", Split: SplitHorizontal, Active: true},
+			},
+		},
+	}
+
+	require.NoError(t, svc.CreateSession("app", t.TempDir(), nil, windows))
+
+	defer func() {
+		require.NoError(t, client.Run(&tmux.KillServer{}))
+	}()
+
+	output, err := client.Output(&tmux.ListPanes{
+		Target: "app",
+		Format: "#{pane_index} #{pane_active} #{pane_title}",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "1 0 top\n2 1 right\n3 0 bottom\n", string(output))
+}
+
+func TestSessionCommands(t *testing.T) {
+	session := &Session{
+		Options:     map[string]string{"status": "off", "mouse": "on"},
+		Environment: map[string]string{"B": "2", "A": "1"},
+		Hooks:       map[string]string{"client-attached": "display-message hi"},
+	}
+
+	windows := []Window{
+		{
+			Name:   "editor",
+			Panes:  []Pane{{Pwd: "src", Env: []string{"C=3"}, Cmd: []string{"vim"}}},
+			Active: true,
+		},
+	}
+
+	cmds, err := sessionCommands("app", "/project", session, windows, 0)
+	require.NoError(t, err)
+	require.Equal(t, []tmux.Command{
+		&tmux.NewSession{
+			SessionName:    "app",
+			WindowName:     "editor",
+			StartDirectory: "/project/src",
+			Environment:    []string{"A=1", "B=2", "C=3"},
+			Detached:       true,
+			Command:        []string{"vim"},
+		},
+		&tmux.SetEnvironment{TargetSession: "app", Name: "A", Value: "1"},
+		&tmux.SetEnvironment{TargetSession: "app", Name: "B", Value: "2"},
+		&tmux.SetOption{Target: "app", Name: "mouse", Value: "on"},
+		&tmux.SetOption{Target: "app", Name: "status", Value: "off"},
+		&tmux.SetHook{TargetSession: "app", Name: "client-attached", Command: "display-message hi"},
+		&tmux.SelectWindow{TargetWindow: "app:^"},
+	}, cmds)
+
+	// Without a session config, only the session is created
+	cmds, err = sessionCommands("app", "/project", nil, []Window{{Panes: []Pane{{}}}}, 0)
+	require.NoError(t, err)
+	require.Equal(t, []tmux.Command{
+		&tmux.NewSession{SessionName: "app", StartDirectory: "/project", Environment: []string{}, Detached: true},
+	}, cmds)
+}
+
+func TestAttachWindow(t *testing.T) {
+	tests := []struct {
+		Name     string
+		InTmux   bool
+		Expected []string
+	}{
+		{
+			Name:     "inside tmux",
+			InTmux:   true,
+			Expected: []string{"switch-client", "-t", "=my session:2"},
+		},
+		{
+			Name:     "outside tmux",
+			Expected: []string{"attach-session", "-t", "=my session:2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			if test.InTmux {
+				t.Setenv("TMUX", "/tmp/tmux-1000/default,1,0")
+			} else {
+				t.Setenv("TMUX", "")
+				os.Unsetenv("TMUX")
+			}
+
+			client, argsPath := fakeTmux(t, "", 0)
+			svc := Service{tmux: client}
+
+			require.NoError(t, svc.AttachWindow("my session", "2"))
+
+			args, err := os.ReadFile(argsPath)
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, strings.Split(strings.TrimSuffix(string(args), "\n"), "\n"))
+		})
+	}
+}
+
+func TestReplaceWindowsWithoutWindows(t *testing.T) {
+	// Nothing is run, since it would kill every window in the session
+	svc := Service{}
+	require.Error(t, svc.ReplaceWindows("app", "/project", nil))
+}
+
+func TestWindowCommands(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Given         Window
+		PaneBaseIndex int
+		Expected      []tmux.Command
+	}{
+		{
+			Name:     "single pane",
+			Given:    Window{Panes: []Pane{{Zoom: true}}},
+			Expected: []tmux.Command{&tmux.ResizePane{TargetPane: "0", Zoom: true}},
+		},
+		{
+			Name: "editor with terminal",
+			Given: Window{
+				Panes: []Pane{
+					{Name: "editor", Active: true, Role: RoleEditor},
+					{Split: SplitVertical, Size: "25%"},
+				},
+			},
+			Expected: []tmux.Command{
+				&tmux.SplitWindow{StartDirectory: "/project", Vertical: true, Size: "25%"},
+				&tmux.SetOption{Target: "0", Pane: true, Name: "@torpedo-role", Value: "editor"},
+				&tmux.SelectPane{TargetPane: "0"},
+			},
+		},
+		{
+			Name: "target",
+			Given: Window{
+				Layout: "tiled",
+				Panes: []Pane{
+					{Name: "left"},
+					{Name: "right", Split: SplitHorizontal},
+					{Target: "left", Active: true},
+					{Zoom: true},
+				},
+			},
+			Expected: []tmux.Command{
+				&tmux.SplitWindow{StartDirectory: "/project", Horizontal: true},
+				&tmux.SplitWindow{StartDirectory: "/project", TargetPane: "0"},
+				&tmux.SplitWindow{StartDirectory: "/project"},
+				&tmux.SelectLayout{LayoutName: "tiled"},
+				&tmux.SelectPane{TargetPane: "1"},
+				&tmux.ResizePane{TargetPane: "2", Zoom: true},
+			},
+		},
+		{
+			Name: "send keys",
+			Given: Window{
+				Panes: []Pane{
+					{Title: "db", SendKeys: []string{"psql"}, WaitFor: &WaitFor{File: "db.sock", TCP: "5432"}},
+					{SendKeys: []string{"echo '#'"}},
+				},
+			},
+			Expected: []tmux.Command{
+				&tmux.SplitWindow{StartDirectory: "/project"},
+				&tmux.SelectPane{TargetPane: "0", Title: "db"},
+				&tmux.RunShell{
+					TargetPane: "0",
+					Background: true,
+					Command:    `'/bin/torpedo' 'wait-for' --target '#{pane_id}' '--file' '/project/db.sock' '--tcp' 'localhost:5432' '--' 'psql'`,
+				},
+				&tmux.SendKeys{TargetPane: "1", Literal: true, Keys: []string{"echo '#'"}},
+				&tmux.SendKeys{TargetPane: "1", Keys: []string{"Enter"}},
+			},
+		},
+		{
+			Name: "pane base index",
+			Given: Window{
+				Panes: []Pane{
+					{Name: "left", Title: "left"},
+					{Split: SplitHorizontal, Zoom: true},
+					{Target: "left", Active: true, SendKeys: []string{"ls"}},
+				},
+			},
+			PaneBaseIndex: 1,
+			Expected: []tmux.Command{
+				&tmux.SplitWindow{StartDirectory: "/project", Horizontal: true},
+				&tmux.SplitWindow{StartDirectory: "/project", TargetPane: "1"},
+				&tmux.SelectPane{TargetPane: "1", Title: "left"},
+				&tmux.SendKeys{TargetPane: "2", Literal: true, Keys: []string{"ls"}},
+				&tmux.SendKeys{TargetPane: "2", Keys: []string{"Enter"}},
+				&tmux.SelectPane{TargetPane: "2"},
+				&tmux.ResizePane{TargetPane: "3", Zoom: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			cmds, err := windowCommands("/project", "/bin/torpedo", test.Given, test.PaneBaseIndex)
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, cmds)
+		})
+	}
+
+	_, err := windowCommands("/project", "/bin/torpedo", Window{Panes: []Pane{{}, {Target: "missing"}}}, 0)
+	require.Error(t, err)
+}
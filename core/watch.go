@@ -0,0 +1,347 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// watchDebounce is how long files have to stop changing before the
+	// command is run again, so that saving several files only runs it once
+	watchDebounce = 200 * time.Millisecond
+	pollInterval  = 500 * time.Millisecond
+)
+
+// watchFilter decides which files in a project are watched.
+type watchFilter struct {
+	root string
+	// globs limit the files that are watched, if there are any
+	globs []string
+
+	mu        sync.RWMutex
+	gitignore *gitignore
+}
+
+// newWatchFilter returns a filter for the project at root, which ignores the
+// files that its .gitignore files do.
+func newWatchFilter(root string, globs []string) (*watchFilter, error) {
+	ignore, err := loadGitignore(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return &watchFilter{root: root, globs: globs, gitignore: ignore}, nil
+}
+
+// reload reads the .gitignore files again, after one of them has changed.
+// The old patterns are kept if they can't be read.
+func (f *watchFilter) reload() {
+	ignore, err := loadGitignore(f.root)
+	if err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	f.gitignore = ignore
+	f.mu.Unlock()
+}
+
+// ignored reports whether Git ignores the file or directory at rel.
+func (f *watchFilter) ignored(rel string, isDir bool) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.gitignore.ignored(filepath.ToSlash(rel), isDir)
+}
+
+// isGitignore reports whether the file at rel is a .gitignore file, which
+// the filter has to be reloaded for when it changes.
+func isGitignore(rel string) bool {
+	return filepath.Base(rel) == ".gitignore"
+}
+
+// skipDir reports whether a directory, and everything in it, is ignored.
+func (f *watchFilter) skipDir(rel string) bool {
+	switch filepath.Base(rel) {
+	case ".git", projectDataDir:
+		return true
+	}
+
+	return f.ignored(rel, true)
+}
+
+// matches reports whether a change to the file at rel should run the
+// command again.
+func (f *watchFilter) matches(rel string) bool {
+	if f.ignored(rel, false) {
+		return false
+	}
+
+	rel = filepath.ToSlash(rel)
+
+	if len(f.globs) == 0 {
+		return true
+	}
+
+	for _, glob := range f.globs {
+		if matchGlob(glob, rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watcher sends the paths of files that change in a project, relative to the
+// project, until it is closed.
+type watcher interface {
+	Changes() <-chan string
+	Close() error
+}
+
+// newWatcher watches the files in a project using inotify if it can, and
+// falls back to polling otherwise, such as when there are too many
+// directories to watch.
+func newWatcher(root string, filter *watchFilter) watcher {
+	if w, err := newInotifyWatcher(root, filter); err == nil {
+		return w
+	}
+
+	return newPollWatcher(root, filter, pollInterval)
+}
+
+// pollWatcher finds changes by comparing the size and modification time of
+// every file at an interval.
+type pollWatcher struct {
+	root    string
+	filter  *watchFilter
+	changes chan string
+	done    chan struct{}
+	// gitignores is the state of every .gitignore file, which are compared
+	// separately, since they might not be watched
+	gitignores map[string]fileState
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+func newPollWatcher(root string, filter *watchFilter, interval time.Duration) *pollWatcher {
+	w := &pollWatcher{
+		root:    root,
+		filter:  filter,
+		changes: make(chan string),
+		done:    make(chan struct{}),
+	}
+
+	// Take the first snapshot now, so that changes made after this returns
+	// are seen
+	files, gitignores := w.snapshot()
+	w.gitignores = gitignores
+
+	go w.poll(files, interval)
+
+	return w
+}
+
+func (w *pollWatcher) Changes() <-chan string { return w.changes }
+
+func (w *pollWatcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+func (w *pollWatcher) poll(files map[string]fileState, interval time.Duration) {
+	defer close(w.changes)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		next, gitignores := w.snapshot()
+
+		// Files that were ignored before are reported as changed once they
+		// aren't
+		if !maps.Equal(gitignores, w.gitignores) {
+			w.gitignores = gitignores
+			w.filter.reload()
+			next, _ = w.snapshot()
+		}
+
+		changed := []string{}
+
+		for rel, state := range next {
+			if old, ok := files[rel]; !ok || old != state {
+				changed = append(changed, rel)
+			}
+		}
+
+		for rel := range files {
+			if _, ok := next[rel]; !ok {
+				changed = append(changed, rel)
+			}
+		}
+
+		files = next
+
+		for _, rel := range changed {
+			select {
+			case w.changes <- rel:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// snapshot returns the state of every watched file, and of every .gitignore
+// file.
+func (w *pollWatcher) snapshot() (map[string]fileState, map[string]fileState) {
+	files := map[string]fileState{}
+	gitignores := map[string]fileState{}
+
+	filepath.WalkDir(w.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can be deleted while walking
+			return nil
+		}
+
+		rel, err := filepath.Rel(w.root, p)
+		if err != nil || rel == "." {
+			return nil
+		}
+
+		if d.IsDir() {
+			if w.filter.skipDir(rel) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		state := fileState{info.Size(), info.ModTime()}
+
+		if isGitignore(rel) {
+			gitignores[rel] = state
+		}
+
+		if w.filter.matches(rel) {
+			files[rel] = state
+		}
+
+		return nil
+	})
+
+	return files, gitignores
+}
+
+// WatchProjectCommand runs a command like [Service.RunProjectCommand], then
+// runs it again whenever the files that it watches change, until ctx is
+// cancelled.
+// If the command is still running when files change, it is killed and
+// restarted.
+// Status messages are written to status.
+func (svc *Service) WatchProjectCommand(ctx context.Context, projectPath, shell string, commands map[string]Command, name string, args []string, status io.Writer) error {
+	command, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("WatchProjectCommand: unknown command %q", name)
+	}
+
+	filter, err := newWatchFilter(projectPath, command.Watch)
+	if err != nil {
+		return fmt.Errorf("WatchProjectCommand: %w", err)
+	}
+
+	w := newWatcher(projectPath, filter)
+	defer w.Close()
+
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+
+		runner := commandRunner{
+			projectPath: projectPath,
+			shell:       shell,
+			commands:    commands,
+			ctx:         runCtx,
+			runs:        map[string]*commandRun{},
+		}
+
+		// Commands can't read from the terminal, since they can be killed
+		// at any time
+		done := make(chan error, 1)
+		go func() {
+			done <- runner.run(name, args, commandIO{nil, os.Stdout, os.Stderr})
+		}()
+
+		finished, err := waitForChanges(ctx, w.Changes(), done, name, status)
+
+		cancel()
+		if !finished {
+			<-done
+		}
+
+		if err != nil || ctx.Err() != nil {
+			return err
+		}
+
+		if finished {
+			fmt.Fprintf(status, "torpedo: files changed, running %s again\n", name)
+		} else {
+			fmt.Fprintf(status, "torpedo: files changed, restarting %s\n", name)
+		}
+	}
+}
+
+// waitForChanges waits until files have changed and then stopped changing for
+// watchDebounce, or until ctx is cancelled.
+// It reports the result of the command if it finishes in the meantime, and
+// whether it did.
+func waitForChanges(ctx context.Context, changes <-chan string, done <-chan error, name string, status io.Writer) (bool, error) {
+	var debounce <-chan time.Time
+
+	finished := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return finished, nil
+		case err := <-done:
+			finished = true
+			done = nil
+
+			if err != nil {
+				fmt.Fprintf(status, "torpedo: %s failed: %s\n", name, err)
+			}
+
+			fmt.Fprintf(status, "torpedo: waiting for changes\n")
+		case _, ok := <-changes:
+			if !ok {
+				return finished, errors.New("WatchProjectCommand: stopped watching files")
+			}
+
+			debounce = time.After(watchDebounce)
+		case <-debounce:
+			return finished, nil
+		}
+	}
+}
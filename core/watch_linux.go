@@ -0,0 +1,181 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF
+
+// inotifyWatcher watches every directory in a project with inotify.
+type inotifyWatcher struct {
+	root    string
+	filter  *watchFilter
+	fd      int
+	file    *os.File
+	changes chan string
+
+	mu sync.Mutex
+	// dirs maps watch descriptors to the directories they watch, relative
+	// to root
+	dirs map[int32]string
+}
+
+func newInotifyWatcher(root string, filter *watchFilter) (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &inotifyWatcher{
+		root:    root,
+		filter:  filter,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		changes: make(chan string, 64),
+		dirs:    map[int32]string{},
+	}
+
+	if err := w.addTree("", false); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	go w.read()
+
+	return w, nil
+}
+
+func (w *inotifyWatcher) Changes() <-chan string { return w.changes }
+
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
+
+// addTree watches the directory at rel and all of its subdirectories that
+// aren't ignored.
+// If report is true, the files that are already in them are reported as
+// changes.
+func (w *inotifyWatcher) addTree(rel string, report bool) error {
+	return filepath.WalkDir(filepath.Join(w.root, rel), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Directories can be deleted while walking
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		child, err := filepath.Rel(w.root, p)
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			if report && w.filter.matches(child) {
+				w.send(child)
+			}
+
+			return nil
+		}
+
+		if child != "." && w.filter.skipDir(child) {
+			return filepath.SkipDir
+		}
+
+		wd, err := syscall.InotifyAddWatch(w.fd, p, inotifyMask)
+		if err != nil {
+			// The watch limit has probably been reached
+			return err
+		}
+
+		w.mu.Lock()
+		w.dirs[int32(wd)] = child
+		w.mu.Unlock()
+
+		return nil
+	})
+}
+
+func (w *inotifyWatcher) read() {
+	defer close(w.changes)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		// The file is non-blocking, so reads wait using the runtime poller,
+		// and return when the file is closed
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+
+			// The name is padded with null bytes
+			name := string(buf[nameStart:offset])
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+
+			w.handle(event, name)
+		}
+	}
+}
+
+func (w *inotifyWatcher) handle(event *syscall.InotifyEvent, name string) {
+	w.mu.Lock()
+	dir, ok := w.dirs[event.Wd]
+	if event.Mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, event.Wd)
+	}
+	w.mu.Unlock()
+
+	if !ok || name == "" {
+		return
+	}
+
+	rel := filepath.Join(dir, name)
+
+	// Directories that were ignored before have to be watched once they
+	// aren't, and a .gitignore file only affects its own directory.
+	// The files in it are reported, like the poll watcher reports files
+	// that stop being ignored.
+	if event.Mask&syscall.IN_ISDIR == 0 && isGitignore(rel) {
+		w.filter.reload()
+		w.addTree(dir, true)
+	}
+
+	if event.Mask&syscall.IN_ISDIR != 0 {
+		// Watch directories as they are created, and report the files that
+		// were created in them before they were watched
+		if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && !w.filter.skipDir(rel) {
+			w.addTree(rel, true)
+		}
+
+		return
+	}
+
+	if w.filter.matches(rel) {
+		w.send(rel)
+	}
+}
+
+// send reports a change, unless changes are already waiting to be received,
+// since one change is enough to run the command again.
+func (w *inotifyWatcher) send(rel string) {
+	select {
+	case w.changes <- rel:
+	default:
+	}
+}
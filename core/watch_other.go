@@ -0,0 +1,9 @@
+//go:build !linux
+
+package core
+
+import "errors"
+
+func newInotifyWatcher(root string, filter *watchFilter) (watcher, error) {
+	return nil, errors.New("inotify is only supported on Linux")
+}
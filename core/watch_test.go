@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	watchers := map[string]func(root string, filter *watchFilter) (watcher, error){
+		"inotify": newInotifyWatcher,
+		"poll": func(root string, filter *watchFilter) (watcher, error) {
+			return newPollWatcher(root, filter, 10*time.Millisecond), nil
+		},
+	}
+
+	for name, newWatcher := range watchers {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.Mkdir(filepath.Join(dir, "vendor"), 0777))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("vendor/\n"), 0666))
+
+			filter, err := newWatchFilter(dir, []string{"**/*.go"})
+			require.NoError(t, err)
+
+			w, err := newWatcher(dir, filter)
+			if name == "inotify" && err != nil {
+				t.Skipf("inotify is unavailable: %s", err)
+			}
+
+			require.NoError(t, err)
+			defer w.Close()
+
+			// A file can be reported more than once, such as when it is
+			// created and then written
+			previous := ""
+			expectChange := func(expected string) {
+				t.Helper()
+
+				timeout := time.After(2 * time.Second)
+				for {
+					select {
+					case rel := <-w.Changes():
+						if rel == previous {
+							continue
+						}
+
+						require.Equal(t, expected, rel)
+						previous = rel
+						return
+					case <-timeout:
+						t.Fatalf("no change to %s", expected)
+					}
+				}
+			}
+
+			// Files that aren't watched are changed first, so that the next
+			// change must be the watched one
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "vendor", "lib.go"), nil, 0666))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), nil, 0666))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), nil, 0666))
+			expectChange("main.go")
+
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg", "sub"), 0777))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg", "sub", "sub.go"), nil, 0666))
+			expectChange(filepath.Join("pkg", "sub", "sub.go"))
+
+			// Files in a directory stop being ignored once .gitignore
+			// changes, although other files can be reported with them
+			require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.log\n"), 0666))
+
+			timeout := time.After(2 * time.Second)
+			for rel := ""; rel != filepath.Join("vendor", "lib.go"); {
+				select {
+				case rel = <-w.Changes():
+				case <-timeout:
+					t.Fatal("vendor is still ignored")
+				}
+			}
+		})
+	}
+}
+
+func TestWatchProjectCommand(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	log := filepath.Join(dir, "runs.log")
+	require.NoError(t, os.Mkdir(project, 0777))
+
+	commands := map[string]Command{
+		// The command keeps running, so it has to be restarted
+		"serve": {Run: "echo run >> $LOG; exec sleep 30", Env: []string{"LOG=" + log}},
+	}
+
+	runs := func() int {
+		data, _ := os.ReadFile(log)
+		return strings.Count(string(data), "run\n")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var status bytes.Buffer
+	done := make(chan error, 1)
+
+	svc := New("")
+	go func() {
+		done <- svc.WatchProjectCommand(ctx, project, "sh", commands, "serve", nil, &status)
+	}()
+
+	require.Eventually(t, func() bool { return runs() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Several changes close together only restart the command once
+	for i := 0; i < 3; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(project, "main.go"), []byte{byte(i)}, 0666))
+	}
+
+	require.Eventually(t, func() bool { return runs() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command was not stopped")
+	}
+
+	require.Equal(t, 2, runs())
+	require.Equal(t, "torpedo: files changed, restarting serve\n", status.String())
+}
@@ -1,11 +1,18 @@
 package format
 
 import (
+	"cmp"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
-	"text/tabwriter"
+	"text/template"
 )
 
 type Formatter interface {
@@ -13,71 +20,440 @@ type Formatter interface {
 	Close() error
 }
 
-func New(format string, fields []string, w io.Writer) (Formatter, error) {
+// Formats are the names of the formats that [New] accepts for any rows, apart
+// from templates.
+var Formats = []string{"text", "json", "json-array", "csv", "tsv", "print0"}
+
+// LocationFormats are the names of the formats for rows that are locations in
+// files, which [New] only accepts if [Options.Locations] is set.
+var LocationFormats = []string{"quickfix", "lsp-locations"}
+
+// New returns a formatter that writes rows in format to w.
+// The text, json, json-array, csv and tsv formats write the given fields of
+// each row, or all of them if fields is nil.
+// The print0 format writes the fields of each row separated by tabs, with a
+// NUL byte after each row, for xargs -0.
+// A format containing {{ is a text/template that is executed with each row,
+// which is followed by a newline, and it can use any field.
+// The quickfix and lsp-locations formats are for rows that are locations in
+// files, and ignore fields, so they are only accepted if opts.Locations is
+// set.
+// They use the path, line and col fields, and quickfix uses the note field as
+// the message, or the mark field if there is no note.
+// Every row needs a path, and quickfix rows also need a line and col.
+func New(format string, fields []string, w io.Writer, opts Options) (Formatter, error) {
+	f, err := newFormatter(format, fields, w, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.Sort) > 0 || opts.Reverse {
+		return &sortFormatter{opts.Sort, opts.Reverse, nil, f}, nil
+	}
+
+	return f, nil
+}
+
+// Options change which rows are written, and how.
+type Options struct {
+	// Sort orders the rows by these fields, with the later fields breaking
+	// ties, instead of the order they are written in.
+	Sort []string
+	// Reverse reverses the order of the rows.
+	Reverse bool
+	// NoHeader leaves out the header of the formats that have one.
+	NoHeader bool
+	// Color colours the text format.
+	Color bool
+	// Width is the width of the terminal that the text format is written to,
+	// which long paths are shortened to fit in, or 0 if it isn't one.
+	Width int
+	// Locations allows the [LocationFormats], since the rows are locations in
+	// files.
+	Locations bool
+}
+
+func newFormatter(format string, fields []string, w io.Writer, opts Options) (Formatter, error) {
 	switch format {
 	case "json":
 		return &jsonFormatter{fields, json.NewEncoder(w)}, nil
+	case "json-array":
+		return &jsonArrayFormatter{fields, w, []map[string]any{}}, nil
 	case "text":
-		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.DiscardEmptyColumns)
-		return &textFormatter{false, fields, tw}, nil
-	default:
-		return nil, fmt.Errorf("invalid format %q", format)
+		return &textFormatter{noHeader: opts.NoHeader, fields: fields, color: opts.Color, width: opts.Width, w: w}, nil
+	case "csv":
+		return &csvFormatter{opts.NoHeader, fields, csv.NewWriter(w)}, nil
+	case "tsv":
+		return &tsvFormatter{opts.NoHeader, fields, w}, nil
+	case "print0":
+		return &print0Formatter{fields, w}, nil
+	case "quickfix", "lsp-locations":
+		if !opts.Locations {
+			return nil, fmt.Errorf("the %s format is only for locations in files, like file marks", format)
+		}
+
+		if format == "quickfix" {
+			return &quickfixFormatter{w}, nil
+		}
+
+		return &lspFormatter{w, []lspLocation{}}, nil
+	}
+
+	if strings.Contains(format, "{{") {
+		tmpl, err := template.New("format").Funcs(templateFuncs).Option("missingkey=error").Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format template: %w", err)
+		}
+
+		return &templateFormatter{tmpl, w}, nil
+	}
+
+	return nil, fmt.Errorf("invalid format %q, expected one of %s or a template", format, strings.Join(Formats, ", "))
+}
+
+// keys returns the fields of a row in sorted order, for formatters that
+// weren't given any fields.
+func keys(m map[string]any) []string {
+	fields := make([]string, 0, len(m))
+	for key := range m {
+		fields = append(fields, key)
+	}
+
+	slices.Sort(fields)
+
+	return fields
+}
+
+// formatRow returns the fields of a row as strings.
+func formatRow(fields []string, m map[string]any) []string {
+	row := make([]string, len(fields))
+	for i, field := range fields {
+		row[i] = formatValue(m[field])
+	}
+
+	return row
+}
+
+func formatValue(value any) string {
+	if list, ok := value.([]string); ok {
+		return strings.Join(list, ",")
+	}
+
+	return fmt.Sprint(value)
+}
+
+type jsonFormatter struct {
+	fields []string
+	*json.Encoder
+}
+
+func (f *jsonFormatter) Write(m map[string]any) error {
+	return f.Encode(filterFields(f.fields, m))
+}
+
+func (f *jsonFormatter) Close() error { return nil }
+
+// filterFields returns the fields of a row, or the whole row if fields is
+// nil.
+func filterFields(fields []string, m map[string]any) map[string]any {
+	if fields == nil {
+		return m
 	}
+
+	filtered := map[string]any{}
+	for _, field := range fields {
+		filtered[field] = m[field]
+	}
+
+	return filtered
+}
+
+// jsonArrayFormatter writes the rows as a single JSON array, once it is
+// closed.
+type jsonArrayFormatter struct {
+	fields []string
+	w      io.Writer
+	rows   []map[string]any
+}
+
+func (f *jsonArrayFormatter) Write(m map[string]any) error {
+	f.rows = append(f.rows, filterFields(f.fields, m))
+	return nil
+}
+
+func (f *jsonArrayFormatter) Close() error {
+	return json.NewEncoder(f.w).Encode(f.rows)
 }
 
-type textFormatter struct {
+type csvFormatter struct {
 	wroteHeaders bool
 	fields       []string
-	tw           *tabwriter.Writer
+	w            *csv.Writer
 }
 
-func (f *textFormatter) Write(m map[string]any) error {
+func (f *csvFormatter) Write(m map[string]any) error {
 	if f.fields == nil {
-		for key := range m {
-			f.fields = append(f.fields, key)
+		f.fields = keys(m)
+	}
+
+	if !f.wroteHeaders {
+		if err := f.w.Write(f.fields); err != nil {
+			return err
 		}
+
+		f.wroteHeaders = true
+	}
+
+	return f.w.Write(formatRow(f.fields, m))
+}
+
+func (f *csvFormatter) Close() error {
+	f.w.Flush()
+	return f.w.Error()
+}
+
+// tsvEscaper escapes the characters that would break up a row in a TSV file.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// tsvFormatter writes the fields separated by single tabs, without lining
+// them up like the text format does.
+type tsvFormatter struct {
+	wroteHeaders bool
+	fields       []string
+	w            io.Writer
+}
+
+func (f *tsvFormatter) Write(m map[string]any) error {
+	if f.fields == nil {
+		f.fields = keys(m)
 	}
 
 	if !f.wroteHeaders {
-		if _, err := fmt.Fprintln(f.tw, strings.Join(f.fields, "\t")); err != nil {
+		if _, err := fmt.Fprintln(f.w, strings.Join(f.fields, "\t")); err != nil {
 			return err
 		}
 
 		f.wroteHeaders = true
 	}
 
-	row := make([]string, len(f.fields))
-	for i, field := range f.fields {
-		row[i] = fmt.Sprint(m[field])
+	row := formatRow(f.fields, m)
+	for i, value := range row {
+		row[i] = tsvEscaper.Replace(value)
 	}
 
-	if _, err := fmt.Fprintln(f.tw, strings.Join(row, "\t")); err != nil {
+	_, err := fmt.Fprintln(f.w, strings.Join(row, "\t"))
+	return err
+}
+
+func (f *tsvFormatter) Close() error { return nil }
+
+type print0Formatter struct {
+	fields []string
+	w      io.Writer
+}
+
+func (f *print0Formatter) Write(m map[string]any) error {
+	if f.fields == nil {
+		f.fields = keys(m)
+	}
+
+	_, err := fmt.Fprint(f.w, strings.Join(formatRow(f.fields, m), "\t"), "\x00")
+	return err
+}
+
+func (f *print0Formatter) Close() error { return nil }
+
+// templateFuncs are the functions that format templates can use, on top of
+// the ones built into text/template.
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+type templateFormatter struct {
+	tmpl *template.Template
+	w    io.Writer
+}
+
+func (f *templateFormatter) Write(m map[string]any) error {
+	if err := f.tmpl.Execute(f.w, m); err != nil {
 		return err
 	}
 
+	_, err := fmt.Fprintln(f.w)
+	return err
+}
+
+func (f *templateFormatter) Close() error { return nil }
+
+// quickfixFormatter writes rows in the format that Vim's default errorformat
+// reads, which is path:line:col: message.
+type quickfixFormatter struct {
+	w io.Writer
+}
+
+func (f *quickfixFormatter) Write(m map[string]any) error {
+	path, _ := m["path"].(string)
+	if path == "" || m["line"] == nil || m["col"] == nil {
+		return errors.New("quickfix needs a path, line and col")
+	}
+
+	message, _ := m["note"].(string)
+	if message == "" {
+		message, _ = m["mark"].(string)
+	}
+
+	// The message is the rest of the line
+	message = strings.ReplaceAll(message, "\n", " ")
+
+	_, err := fmt.Fprintf(f.w, "%s:%v:%v: %s\n", path, m["line"], m["col"], message)
+	return err
+}
+
+func (f *quickfixFormatter) Close() error { return nil }
+
+// lspFormatter writes the rows as a JSON array of LSP Location objects, once
+// it is closed.
+type lspFormatter struct {
+	w         io.Writer
+	locations []lspLocation
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+// lspPosition is a position in a file, with the line and character counting
+// from 0.
+type lspPosition struct {
+	Line      uint64 `json:"line"`
+	Character uint64 `json:"character"`
+}
+
+func (f *lspFormatter) Write(m map[string]any) error {
+	path, ok := m["path"].(string)
+	if !ok {
+		return errors.New("lsp-locations needs a path")
+	}
+
+	// Lines and columns start at 1 in the rows
+	position := lspPosition{
+		Line:      max(toUint(m["line"]), 1) - 1,
+		Character: max(toUint(m["col"]), 1) - 1,
+	}
+
+	uri := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+
+	f.locations = append(f.locations, lspLocation{uri.String(), lspRange{position, position}})
+
 	return nil
 }
 
-func (f *textFormatter) Close() error { return f.tw.Flush() }
+func (f *lspFormatter) Close() error {
+	return json.NewEncoder(f.w).Encode(f.locations)
+}
 
-type jsonFormatter struct {
-	fields []string
-	*json.Encoder
+func toUint(value any) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int:
+		return uint64(max(v, 0))
+	}
+
+	return 0
 }
 
-func (f *jsonFormatter) Write(m map[string]any) error {
-	if f.fields == nil {
-		for key := range m {
-			f.fields = append(f.fields, key)
+// sortFormatter collects the rows, and writes them to another formatter in
+// order once it is closed.
+type sortFormatter struct {
+	fields  []string
+	reverse bool
+	rows    []map[string]any
+	Formatter
+}
+
+func (f *sortFormatter) Write(m map[string]any) error {
+	for _, field := range f.fields {
+		if _, ok := m[field]; !ok {
+			return fmt.Errorf("can't sort by %q, it isn't one of the fields", field)
 		}
 	}
 
-	filtered := map[string]any{}
-	for _, field := range f.fields {
-		filtered[field] = m[field]
+	f.rows = append(f.rows, m)
+
+	return nil
+}
+
+func (f *sortFormatter) Close() error {
+	// The sort is stable, so rows that are equal stay in the order they were
+	// written in, even when the order is reversed
+	if len(f.fields) > 0 {
+		slices.SortStableFunc(f.rows, func(a, b map[string]any) int {
+			for _, field := range f.fields {
+				if c := compareValues(a[field], b[field]); c != 0 {
+					if f.reverse {
+						return -c
+					}
+
+					return c
+				}
+			}
+
+			return 0
+		})
+	} else if f.reverse {
+		slices.Reverse(f.rows)
+	}
+
+	for _, row := range f.rows {
+		if err := f.Formatter.Write(row); err != nil {
+			return err
+		}
 	}
 
-	return f.Encode(filtered)
+	return f.Formatter.Close()
 }
 
-func (f *jsonFormatter) Close() error { return nil }
+// compareValues compares numbers by value, false before true, and everything
+// else by how it is written.
+// Strings that are both whole numbers, like mark keys, are compared as
+// numbers.
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			ai, aErr := strconv.Atoi(a)
+			bi, bErr := strconv.Atoi(b)
+			if aErr == nil && bErr == nil {
+				return cmp.Compare(ai, bi)
+			}
+		}
+	case uint64:
+		if b, ok := b.(uint64); ok {
+			return cmp.Compare(a, b)
+		}
+	case int:
+		if b, ok := b.(int); ok {
+			return cmp.Compare(a, b)
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0
+			case b:
+				return -1
+			default:
+				return 1
+			}
+		}
+	}
+
+	return strings.Compare(formatValue(a), formatValue(b))
+}
@@ -0,0 +1,276 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// render writes the rows in format, and returns the output.
+func render(format string, fields []string, opts Options, rows ...map[string]any) (string, error) {
+	var buf bytes.Buffer
+
+	f, err := New(format, fields, &buf, opts)
+	if err != nil {
+		return "", err
+	}
+
+	for _, row := range rows {
+		if err := f.Write(row); err != nil {
+			return "", err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Format   string
+		Fields   []string
+		Options  Options
+		Rows     []map[string]any
+		Expected string
+		Error    bool
+	}{
+		{
+			Name:     "csv quoting",
+			Format:   "csv",
+			Fields:   []string{"name", "note"},
+			Rows:     []map[string]any{{"name": "a,b", "note": `say "hi"`}, {"name": "c", "note": "two\nlines"}},
+			Expected: "name,note\n\"a,b\",\"say \"\"hi\"\"\"\nc,\"two\nlines\"\n",
+		},
+		{
+			Name:     "csv without header",
+			Format:   "csv",
+			Fields:   []string{"name"},
+			Options:  Options{NoHeader: true},
+			Rows:     []map[string]any{{"name": "a"}},
+			Expected: "a\n",
+		},
+		{
+			Name:     "csv lists",
+			Format:   "csv",
+			Fields:   []string{"tags"},
+			Rows:     []map[string]any{{"tags": []string{"a", "b"}}},
+			Expected: "tags\n\"a,b\"\n",
+		},
+		{
+			Name:     "csv without fields",
+			Format:   "csv",
+			Rows:     []map[string]any{{"b": 1, "a": 2, "c": true}},
+			Expected: "a,b,c\n2,1,true\n",
+		},
+		{
+			Name:     "tsv escaping",
+			Format:   "tsv",
+			Fields:   []string{"name", "note"},
+			Rows:     []map[string]any{{"name": "a\tb", "note": "c\\d\ne\rf"}},
+			Expected: "name\tnote\na\\tb\tc\\\\d\\ne\\rf\n",
+		},
+		{
+			Name:     "tsv without fields",
+			Format:   "tsv",
+			Options:  Options{NoHeader: true},
+			Rows:     []map[string]any{{"b": 1, "a": 2}},
+			Expected: "2\t1\n",
+		},
+		{
+			Name:     "json-array without rows",
+			Format:   "json-array",
+			Fields:   []string{"name"},
+			Expected: "[]\n",
+		},
+		{
+			Name:     "json-array",
+			Format:   "json-array",
+			Fields:   []string{"name"},
+			Rows:     []map[string]any{{"name": "a", "other": 1}, {"name": "b"}},
+			Expected: "[{\"name\":\"a\"},{\"name\":\"b\"}]\n",
+		},
+		{
+			Name:     "json without fields",
+			Format:   "json",
+			Rows:     []map[string]any{{"name": "a", "other": 1}},
+			Expected: "{\"name\":\"a\",\"other\":1}\n",
+		},
+		{
+			Name:     "print0",
+			Format:   "print0",
+			Fields:   []string{"a", "b"},
+			Rows:     []map[string]any{{"a": "x y", "b": 1}, {"a": "z", "b": 2}},
+			Expected: "x y\t1\x00z\t2\x00",
+		},
+		{
+			Name:     "print0 without fields",
+			Format:   "print0",
+			Rows:     []map[string]any{{"b": 1, "a": 2}},
+			Expected: "2\t1\x00",
+		},
+		{
+			Name:     "template",
+			Format:   `{{.name}}: {{join .tags ","}}`,
+			Fields:   []string{"name"},
+			Rows:     []map[string]any{{"name": "a", "tags": []string{"x", "y"}}},
+			Expected: "a: x,y\n",
+		},
+		{
+			Name:   "template with a missing key",
+			Format: "{{.missing}}",
+			Rows:   []map[string]any{{"name": "a"}},
+			Error:  true,
+		},
+		{
+			Name:   "invalid template",
+			Format: "{{.name",
+			Error:  true,
+		},
+		{
+			Name:   "unknown format",
+			Format: "yaml",
+			Error:  true,
+		},
+		{
+			Name:     "quickfix",
+			Format:   "quickfix",
+			Options:  Options{Locations: true},
+			Rows:     []map[string]any{{"path": "/p/a.go", "line": uint64(3), "col": uint64(1), "mark": "a", "note": "two\nlines"}, {"path": "/p/b.go", "line": uint64(1), "col": uint64(2), "mark": "b"}},
+			Expected: "/p/a.go:3:1: two lines\n/p/b.go:1:2: b\n",
+		},
+		{
+			Name:    "quickfix without a line",
+			Format:  "quickfix",
+			Options: Options{Locations: true},
+			Rows:    []map[string]any{{"path": "/p/a.go", "col": uint64(1)}},
+			Error:   true,
+		},
+		{
+			Name:   "quickfix for rows that aren't locations",
+			Format: "quickfix",
+			Error:  true,
+		},
+		{
+			Name:     "lsp-locations",
+			Format:   "lsp-locations",
+			Options:  Options{Locations: true},
+			Rows:     []map[string]any{{"path": "/p/a b.go", "line": uint64(3), "col": uint64(2)}},
+			Expected: "[{\"uri\":\"file:///p/a%20b.go\",\"range\":{\"start\":{\"line\":2,\"character\":1},\"end\":{\"line\":2,\"character\":1}}}]\n",
+		},
+		{
+			Name:    "lsp-locations without a path",
+			Format:  "lsp-locations",
+			Options: Options{Locations: true},
+			Rows:    []map[string]any{{"line": uint64(3)}},
+			Error:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			output, err := render(test.Format, test.Fields, test.Options, test.Rows...)
+			if test.Error {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, output)
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	rows := []map[string]any{
+		{"mark": "10", "line": uint64(2), "stale": true, "name": "a"},
+		{"mark": "2", "line": uint64(10), "stale": false, "name": "b"},
+		{"mark": "x", "line": uint64(2), "stale": false, "name": "c"},
+		{"mark": "9", "line": uint64(1), "stale": true, "name": "d"},
+	}
+
+	tests := []struct {
+		Name     string
+		Sort     []string
+		Reverse  bool
+		Expected string
+	}{
+		{
+			Name:     "unsorted",
+			Expected: "a\nb\nc\nd\n",
+		},
+		{
+			Name:     "reversed",
+			Reverse:  true,
+			Expected: "d\nc\nb\na\n",
+		},
+		{
+			Name:     "numbers in strings",
+			Sort:     []string{"mark"},
+			Expected: "b\nd\na\nc\n",
+		},
+		{
+			Name:     "numbers",
+			Sort:     []string{"line"},
+			Expected: "d\na\nc\nb\n",
+		},
+		{
+			Name:     "ties stay in order",
+			Sort:     []string{"stale"},
+			Expected: "b\nc\na\nd\n",
+		},
+		{
+			Name:     "ties stay in order when reversed",
+			Sort:     []string{"stale"},
+			Reverse:  true,
+			Expected: "a\nd\nb\nc\n",
+		},
+		{
+			Name:     "later fields break ties",
+			Sort:     []string{"line", "stale"},
+			Expected: "d\nc\na\nb\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			output, err := render("{{.name}}", nil, Options{Sort: test.Sort, Reverse: test.Reverse}, rows...)
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, output)
+		})
+	}
+
+	_, err := render("text", nil, Options{Sort: []string{"missing"}}, rows...)
+	require.Error(t, err)
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		A, B     any
+		Expected int
+	}{
+		{"2", "10", -1},
+		{"10", "10", 0},
+		{"-1", "1", -1},
+		{"b", "a", 1},
+		{"10", "a", -1},
+		{"10", "9a", -1},
+		{uint64(9), uint64(10), -1},
+		{9, 10, -1},
+		{false, true, -1},
+		{true, false, 1},
+		{true, true, 0},
+		// Different types are compared by how they are written
+		{uint64(10), "9", -1},
+		{true, 1, 1},
+		{nil, "a", -1},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.Expected, compareValues(test.A, test.B), "compareValues(%#v, %#v)", test.A, test.B)
+	}
+}
@@ -0,0 +1,195 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// columnGap is the number of spaces between the columns of the text format.
+const columnGap = 2
+
+// minPathWidth is the narrowest that a path is shortened to, so that enough of
+// it is left to recognise.
+const minPathWidth = 16
+
+// pathFields are the fields that hold paths, which are shortened to fit the
+// terminal.
+var pathFields = map[string]bool{
+	"path":    true,
+	"file":    true,
+	"project": true,
+	"source":  true,
+}
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// textFormatter lines the rows up in columns.
+// The rows are collected until it is closed, since the widths of the columns
+// depend on all of them.
+type textFormatter struct {
+	noHeader bool
+	fields   []string
+	rows     [][]string
+	color    bool
+	width    int
+	w        io.Writer
+}
+
+func (f *textFormatter) Write(m map[string]any) error {
+	if f.fields == nil {
+		f.fields = keys(m)
+	}
+
+	f.rows = append(f.rows, formatRow(f.fields, m))
+
+	return nil
+}
+
+func (f *textFormatter) Close() error {
+	if len(f.rows) == 0 {
+		return nil
+	}
+
+	rows := f.rows
+	if !f.noHeader {
+		rows = append([][]string{f.fields}, rows...)
+	}
+
+	widths := make([]int, len(f.fields))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	// Columns that are empty in every row are left out, which can only
+	// happen without the header
+	columns := []int{}
+	for i, width := range widths {
+		if width > 0 {
+			columns = append(columns, i)
+		}
+	}
+
+	if f.width > 0 {
+		f.fit(widths, columns)
+	}
+
+	for i, row := range rows {
+		header := i == 0 && !f.noHeader
+
+		var line strings.Builder
+
+		for j, column := range columns {
+			cell := shorten(row[column], widths[column])
+			padding := widths[column] - utf8.RuneCountInString(cell)
+
+			if f.color {
+				cell = colorize(f.fields[column], cell, header)
+			}
+
+			line.WriteString(cell)
+
+			if j < len(columns)-1 {
+				line.WriteString(strings.Repeat(" ", padding+columnGap))
+			}
+		}
+
+		if _, err := fmt.Fprintln(f.w, strings.TrimRight(line.String(), " ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fit narrows the widest path columns to the same width, as little as is
+// needed for the columns that are shown to fit in the width of the terminal.
+// Paths aren't narrowed below minPathWidth, so the rows can still be too wide.
+func (f *textFormatter) fit(widths []int, columns []int) {
+	total := func(limit int) int {
+		sum := columnGap * (len(columns) - 1)
+		for _, i := range columns {
+			if pathFields[f.fields[i]] {
+				sum += min(widths[i], limit)
+			} else {
+				sum += widths[i]
+			}
+		}
+
+		return sum
+	}
+
+	limit := 0
+	for _, i := range columns {
+		if pathFields[f.fields[i]] {
+			limit = max(limit, widths[i])
+		}
+	}
+
+	for limit > minPathWidth && total(limit) > f.width {
+		limit--
+	}
+
+	for _, i := range columns {
+		if pathFields[f.fields[i]] {
+			widths[i] = min(widths[i], limit)
+		}
+	}
+}
+
+// shorten cuts characters out of the middle of s so that it is at most width
+// characters wide, since the start and end of a path say the most about it.
+func shorten(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+
+	if width < 1 {
+		return ""
+	}
+
+	head := (width - 1) / 2
+	tail := width - 1 - head
+
+	return string(runes[:head]) + "…" + string(runes[len(runes)-tail:])
+}
+
+// colorize colours a cell by the field it is in.
+func colorize(field, cell string, header bool) string {
+	color := ""
+
+	switch {
+	case header:
+		color = ansiBold
+	case field == "mark":
+		color = ansiYellow
+	case pathFields[field]:
+		color = ansiCyan
+	case cell == "attached":
+		color = ansiGreen
+	case cell == "detached":
+		color = ansiDim
+	case field == "stale" && cell == "true", cell == "stale":
+		color = ansiRed
+	case field == "stale":
+		color = ansiDim
+	}
+
+	if color == "" || cell == "" {
+		return cell
+	}
+
+	return color + cell + ansiReset
+}
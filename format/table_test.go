@@ -0,0 +1,138 @@
+package format
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextFormatter(t *testing.T) {
+	long := "/home/user/projects/torpedo/cmd/filemarks.go"
+	longer := "/home/user/projects/torpedo/core/testdata/tmux/config/base.conf"
+
+	tests := []struct {
+		Name     string
+		Fields   []string
+		Options  Options
+		Rows     []map[string]any
+		Expected []string
+	}{
+		{
+			Name:     "columns",
+			Fields:   []string{"mark", "path"},
+			Rows:     []map[string]any{{"mark": "1", "path": "~/a"}, {"mark": "10", "path": "~/b"}},
+			Expected: []string{"mark  path", "1     ~/a", "10    ~/b"},
+		},
+		{
+			Name:     "no rows",
+			Fields:   []string{"mark", "path"},
+			Expected: []string{},
+		},
+		{
+			Name:     "no rows without header",
+			Fields:   []string{"mark", "path"},
+			Options:  Options{NoHeader: true},
+			Expected: []string{},
+		},
+		{
+			Name:     "empty columns are kept with the header",
+			Fields:   []string{"mark", "note", "path"},
+			Rows:     []map[string]any{{"mark": "1", "note": "", "path": "~/a"}},
+			Expected: []string{"mark  note  path", "1           ~/a"},
+		},
+		{
+			Name:     "empty columns are left out without the header",
+			Fields:   []string{"mark", "note", "path"},
+			Options:  Options{NoHeader: true},
+			Rows:     []map[string]any{{"mark": "1", "note": "", "path": "~/a"}},
+			Expected: []string{"1  ~/a"},
+		},
+		{
+			Name:     "fits",
+			Fields:   []string{"mark", "path"},
+			Options:  Options{Width: 80},
+			Rows:     []map[string]any{{"mark": "1", "path": long}},
+			Expected: []string{"mark  path", "1     " + long},
+		},
+		{
+			Name:     "shortened",
+			Fields:   []string{"mark", "path"},
+			Options:  Options{Width: 30},
+			Rows:     []map[string]any{{"mark": "1", "path": long}},
+			Expected: []string{"mark  path", "1     /home/user/…filemarks.go"},
+		},
+		{
+			Name:     "only paths are shortened",
+			Fields:   []string{"mark", "note"},
+			Options:  Options{Width: 10},
+			Rows:     []map[string]any{{"mark": "1", "note": "a note that is too long"}},
+			Expected: []string{"mark  note", "1     a note that is too long"},
+		},
+		{
+			Name:     "narrower than the other columns",
+			Fields:   []string{"note", "path"},
+			Options:  Options{Width: 20},
+			Rows:     []map[string]any{{"note": "a note that is too long", "path": long}},
+			Expected: []string{"note                     path", "a note that is too long  /home/u…marks.go"},
+		},
+		{
+			Name:    "only the widest path is shortened",
+			Fields:  []string{"file", "path"},
+			Options: Options{Width: 100},
+			Rows:    []map[string]any{{"file": long, "path": longer}},
+			Expected: []string{
+				"file                                          path",
+				long + "  /home/user/projects/torped…tdata/tmux/config/base.conf",
+			},
+		},
+		{
+			Name:    "paths are shortened to the same width",
+			Fields:  []string{"file", "path"},
+			Options: Options{Width: 60},
+			Rows:    []map[string]any{{"file": long, "path": longer}},
+			Expected: []string{
+				"file                           path",
+				"/home/user/pro…d/filemarks.go  /home/user/pro…nfig/base.conf",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			output, err := render("text", test.Fields, test.Options, test.Rows...)
+			require.NoError(t, err)
+
+			lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+			if output == "" {
+				lines = []string{}
+			}
+
+			require.Equal(t, test.Expected, lines)
+		})
+	}
+}
+
+func TestShorten(t *testing.T) {
+	tests := []struct {
+		Text     string
+		Width    int
+		Expected string
+	}{
+		{"abcdef", 10, "abcdef"},
+		{"abcdef", 6, "abcdef"},
+		{"abcdef", 5, "ab…ef"},
+		{"abcdef", 4, "a…ef"},
+		{"abcdef", 1, "…"},
+		{"abcdef", 0, ""},
+		{"äöüßäöüß", 5, "äö…üß"},
+		{"~/日本語/プロジェクト", 7, "~/日…ェクト"},
+	}
+
+	for _, test := range tests {
+		shortened := shorten(test.Text, test.Width)
+		require.Equal(t, test.Expected, shortened, "shorten(%q, %d)", test.Text, test.Width)
+		require.LessOrEqual(t, utf8.RuneCountInString(shortened), max(test.Width, 0))
+	}
+}
@@ -0,0 +1,32 @@
+package format
+
+import (
+	"io"
+	"os"
+	"strconv"
+)
+
+// Terminal reports whether w is a terminal, and how many columns wide it is,
+// or 0 if that isn't known.
+func Terminal(w io.Writer) (bool, int) {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false, 0
+	}
+
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false, 0
+	}
+
+	if columns := terminalWidth(f); columns > 0 {
+		return true, columns
+	}
+
+	// Shells set COLUMNS, though they don't always export it
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return true, columns
+	}
+
+	return true, 0
+}
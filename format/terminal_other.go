@@ -0,0 +1,11 @@
+//go:build !unix
+
+package format
+
+import "os"
+
+// terminalWidth returns 0, since the width of the terminal is only known on
+// Unix, and COLUMNS is used instead.
+func terminalWidth(f *os.File) int {
+	return 0
+}
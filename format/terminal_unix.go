@@ -0,0 +1,24 @@
+//go:build unix
+
+package format
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminalWidth asks the terminal f how many columns wide it is, and returns
+// 0 if it can't.
+func terminalWidth(f *os.File) int {
+	var size struct {
+		Rows, Cols, X, Y uint16
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0
+	}
+
+	return int(size.Cols)
+}
@@ -4,11 +4,14 @@ go 1.22.7
 
 require (
 	github.com/alecthomas/kong v1.2.1
+	// The TOML configs are parsed with the unstable API, which can change in any
+	// release, so check core/node_toml.go and its tests before upgrading
+	github.com/pelletier/go-toml/v2 v2.2.3
 	github.com/stretchr/testify v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
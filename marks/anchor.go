@@ -0,0 +1,157 @@
+package marks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// anchorContext is the number of lines before and after the marked line that
+// are stored in an anchor.
+const anchorContext = 2
+
+// Anchor is the content of a file around a file mark.
+type Anchor struct {
+	// Text is the marked line.
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+	// Hash is a hash of the context and the marked line, to tell whether
+	// anything around the mark has changed.
+	Hash string `json:"hash"`
+}
+
+// NewAnchor returns the anchor for line in a file with lines, counting from 1.
+// It returns nil if the file doesn't have that line.
+func NewAnchor(lines []string, line uint64) *Anchor {
+	if line < 1 || line > uint64(len(lines)) {
+		return nil
+	}
+
+	i := int(line - 1)
+
+	a := &Anchor{
+		Text:   lines[i],
+		Before: lines[max(i-anchorContext, 0):i],
+		After:  lines[i+1 : min(i+1+anchorContext, len(lines))],
+	}
+
+	a.Hash = a.hash()
+
+	return a
+}
+
+func (a *Anchor) hash() string {
+	h := sha256.New()
+
+	for _, line := range a.Before {
+		h.Write([]byte(line + "\n"))
+	}
+
+	h.Write([]byte(a.Text + "\n"))
+
+	for _, line := range a.After {
+		h.Write([]byte(line + "\n"))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Locate finds the line in a file with lines that the anchor is for, starting
+// from the line it was at before, and reports whether it found one.
+// The line with the same text and the most matching context wins, with lines
+// closer to the old line breaking ties.
+// If no line has the same text, lines with the same text apart from leading
+// and trailing whitespace are tried, in case the indentation changed.
+func (a *Anchor) Locate(lines []string, line uint64) (uint64, bool) {
+	if current := NewAnchor(lines, line); current != nil && current.Hash == a.Hash {
+		return line, true
+	}
+
+	for _, equal := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) },
+	} {
+		best, bestScore, bestDistance := -1, -1, 0
+
+		for i, text := range lines {
+			if !equal(text, a.Text) {
+				continue
+			}
+
+			score := 0
+
+			for k, before := range a.Before {
+				j := i - len(a.Before) + k
+				if j >= 0 && equal(lines[j], before) {
+					score++
+				}
+			}
+
+			for k, after := range a.After {
+				j := i + 1 + k
+				if j < len(lines) && equal(lines[j], after) {
+					score++
+				}
+			}
+
+			distance := i + 1 - int(line)
+			if distance < 0 {
+				distance = -distance
+			}
+
+			if score > bestScore || (score == bestScore && distance < bestDistance) {
+				best, bestScore, bestDistance = i, score, distance
+			}
+		}
+
+		if best >= 0 {
+			return uint64(best + 1), true
+		}
+	}
+
+	return line, false
+}
+
+// ReadLines reads the lines of a file, without their line endings.
+func ReadLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	return lines, nil
+}
+
+// Relocate moves the mark to where its anchor is in the file, which is at
+// Path in projectDir, and refreshes the anchor.
+// It reports false if the mark is stale, because the file or the anchor can't
+// be found.
+// Marks without anchors are never moved.
+func (fm FileMark) Relocate(projectDir string) (FileMark, bool) {
+	lines, err := ReadLines(filepath.Join(projectDir, fm.Path))
+	if err != nil {
+		return fm, false
+	}
+
+	if fm.Anchor == nil {
+		return fm, true
+	}
+
+	line, ok := fm.Anchor.Locate(lines, fm.Line)
+	if !ok {
+		return fm, false
+	}
+
+	fm.Line = line
+	fm.Anchor = NewAnchor(lines, line)
+
+	return fm, true
+}
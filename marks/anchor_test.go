@@ -0,0 +1,124 @@
+package marks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnchorLocate(t *testing.T) {
+	original := []string{
+		"package main",
+		"",
+		"func a() {",
+		"	return",
+		"}",
+		"",
+		"func b() {",
+		"	return",
+		"}",
+	}
+
+	tests := []struct {
+		Name     string
+		Line     uint64
+		Lines    []string
+		Expected uint64
+		Found    bool
+	}{
+		{
+			Name:     "unchanged",
+			Line:     7,
+			Lines:    original,
+			Expected: 7,
+			Found:    true,
+		},
+		{
+			Name:     "lines added above",
+			Line:     7,
+			Lines:    append([]string{"// Comment", "// Another"}, original...),
+			Expected: 9,
+			Found:    true,
+		},
+		{
+			Name:     "lines removed above",
+			Line:     7,
+			Lines:    original[2:],
+			Expected: 5,
+			Found:    true,
+		},
+		{
+			Name:     "duplicate line chosen by context",
+			Line:     8,
+			Lines:    append([]string{"import \"fmt\"", ""}, original...),
+			Expected: 10,
+			Found:    true,
+		},
+		{
+			Name: "indentation changed",
+			Line: 7,
+			Lines: []string{
+				"package main",
+				"",
+				"type T struct{}",
+				"",
+				"	func b() {",
+				"		return",
+				"	}",
+			},
+			Expected: 5,
+			Found:    true,
+		},
+		{
+			Name:     "line removed",
+			Line:     7,
+			Lines:    original[:6],
+			Expected: 7,
+			Found:    false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			anchor := NewAnchor(original, test.Line)
+			require.NotNil(t, anchor)
+
+			line, found := anchor.Locate(test.Lines, test.Line)
+			require.Equal(t, test.Found, found)
+			require.Equal(t, test.Expected, line)
+		})
+	}
+}
+
+func TestNewAnchorOutOfRange(t *testing.T) {
+	require.Nil(t, NewAnchor([]string{"a"}, 0))
+	require.Nil(t, NewAnchor([]string{"a"}, 2))
+}
+
+func TestFileMarkRelocate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+
+	require.NoError(t, os.WriteFile(path, []byte("a\nb\nc\n"), 0644))
+
+	lines, err := ReadLines(path)
+	require.NoError(t, err)
+
+	mark := File("main.go", 2, 1)
+	mark.Anchor = NewAnchor(lines, 2)
+
+	require.NoError(t, os.WriteFile(path, []byte("x\ny\na\nb\nc\n"), 0644))
+
+	moved, ok := mark.Relocate(dir)
+	require.True(t, ok)
+	require.Equal(t, uint64(4), moved.Line)
+	require.Equal(t, "b", moved.Anchor.Text)
+	require.Equal(t, []string{"y", "a"}, moved.Anchor.Before)
+
+	require.NoError(t, os.Remove(path))
+
+	_, ok = mark.Relocate(dir)
+	require.False(t, ok)
+}
@@ -0,0 +1,160 @@
+package marks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Version is the version of the format that marks files are written in.
+// Files without a version were written before the format had one.
+const Version = 1
+
+// versionedFile is the format that marks files are written in.
+type versionedFile struct {
+	Version int `json:"version"`
+	Marks   any `json:"marks"`
+}
+
+// readFile reads the marks in the file at path into marks, which must be a
+// pointer.
+// It does nothing if the file does not exist.
+func readFile(path string, marks any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	// Files from before the version was added only contain the marks, so
+	// they don't have a version, unless a mark happens to be called
+	// "version", in which case it isn't a number
+	version := 0
+
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(data, &header); err == nil {
+		json.Unmarshal(header["version"], &version)
+	}
+
+	if version == 0 {
+		return json.Unmarshal(data, marks)
+	}
+
+	if version > Version {
+		return fmt.Errorf("%s was written by a newer version of torpedo (format version %d, expected at most %d)", path, version, Version)
+	}
+
+	return json.Unmarshal(data, &versionedFile{Marks: marks})
+}
+
+// writeFile writes marks to the file at path.
+// The marks are written to a temporary file which then replaces the file, so
+// that readers never see a partially written file.
+func writeFile(path string, marks any) error {
+	data, err := json.MarshalIndent(versionedFile{Version, marks}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	data = append(data, '\n')
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	// The temporary file has to be in the same directory, because renaming
+	// only replaces the file atomically within a file system
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	// Temporary files are only readable by their owner
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// lockFile waits until it has an exclusive lock for the file at path, and
+// returns a function that unlocks it.
+// A separate lock file is locked, since the file itself is replaced on every
+// write.
+func lockFile(path string) (func(), error) {
+	lockPath, err := lockFilePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lock(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Closing the file releases the lock
+	return func() { f.Close() }, nil
+}
+
+// lockFilePath returns the path of the lock file for the file at path.
+// Lock files are kept in the user's runtime directory, or their cache
+// directory if there isn't one, rather than next to the file, so that they
+// don't end up in projects.
+// They are named after a hash of the absolute path, so every path to the same
+// file gets the same lock.
+func lockFilePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if !filepath.IsAbs(dir) {
+		dir, err = os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	sum := sha256.Sum256([]byte(path))
+
+	return filepath.Join(dir, "torpedo", "locks", hex.EncodeToString(sum[:])+".lock"), nil
+}
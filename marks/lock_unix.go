@@ -0,0 +1,13 @@
+//go:build unix
+
+package marks
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock waits until it has an exclusive lock for f.
+func lock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
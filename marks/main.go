@@ -1,90 +1,323 @@
 package marks
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 )
 
-type Marks map[string]string
+// Marks are projects that can be jumped to by key, in the order they are
+// listed in.
+type Marks []Mark
+
+type Mark struct {
+	Key     string `json:"key"`
+	Project string `json:"project"`
+}
 
 func ReadMarks(path string) (Marks, error) {
-	data, err := os.ReadFile(path)
+	m := Marks{}
+	if err := readFile(path, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// UpdateMarks reads the marks at path, changes them with update and writes
+// them back, while holding a lock so that other updates can't happen in
+// between.
+// Nothing is written if update returns an error.
+func UpdateMarks(path string, update func(m *Marks) error) error {
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	m, err := ReadMarks(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return Marks{}, nil
+		return err
+	}
+
+	if err := update(&m); err != nil {
+		return err
+	}
+
+	return m.Write(path)
+}
+
+// UnmarshalJSON reads a list of marks, or an object mapping keys to projects,
+// which is how marks used to be stored.
+// The keys of an object are sorted, with numbers first in numeric order.
+func (m *Marks) UnmarshalJSON(data []byte) error {
+	var legacy map[string]string
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		keys := make([]string, 0, len(legacy))
+		for key := range legacy {
+			keys = append(keys, key)
 		}
 
-		return nil, err
+		slices.SortFunc(keys, compareKeys)
+
+		*m = Marks{}
+		for _, key := range keys {
+			*m = append(*m, Mark{key, legacy[key]})
+		}
+
+		return nil
 	}
 
-	var m Marks
-	if err := json.Unmarshal(data, &m); err != nil {
-		return nil, err
+	return json.Unmarshal(data, (*[]Mark)(m))
+}
+
+func compareKeys(a, b string) int {
+	ai, aErr := strconv.Atoi(a)
+	bi, bErr := strconv.Atoi(b)
+
+	switch {
+	case aErr == nil && bErr == nil:
+		return cmp.Compare(ai, bi)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
 	}
 
-	return m, nil
+	return strings.Compare(a, b)
 }
 
 func (m Marks) Write(path string) error {
-	data, err := json.MarshalIndent(m, "", "  ")
-	if err != nil {
-		return err
+	return writeFile(path, m)
+}
+
+// Index returns the position of the mark with key, or -1 if there isn't one.
+func (m Marks) Index(key string) int {
+	return slices.IndexFunc(m, func(mark Mark) bool { return mark.Key == key })
+}
+
+// Get returns the project marked with key.
+func (m Marks) Get(key string) (string, bool) {
+	if i := m.Index(key); i >= 0 {
+		return m[i].Project, true
 	}
 
-	data = append(data, '\n')
+	return "", false
+}
 
-	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
-		return err
+// Set marks project with key, keeping the position of the mark if it exists,
+// or adding it to the end otherwise.
+func (m *Marks) Set(key, project string) {
+	if i := m.Index(key); i >= 0 {
+		(*m)[i].Project = project
+		return
 	}
 
-	return os.WriteFile(path, data, 0666)
+	*m = append(*m, Mark{key, project})
 }
 
-type FileMarks map[string]FileMark
+// Add marks project with the smallest number that isn't a key yet, and
+// returns the key.
+// If project is already marked, its key is returned instead.
+func (m *Marks) Add(project string) string {
+	for _, mark := range *m {
+		if mark.Project == project {
+			return mark.Key
+		}
+	}
 
-func ReadFileMarks(path string) (FileMarks, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return FileMarks{}, nil
+	key := m.NextFreeKey()
+	*m = append(*m, Mark{key, project})
+
+	return key
+}
+
+// NextFreeKey returns the smallest number that isn't a key yet.
+func (m Marks) NextFreeKey() string {
+	for n := 0; ; n++ {
+		if key := strconv.Itoa(n); m.Index(key) < 0 {
+			return key
 		}
+	}
+}
 
-		return nil, err
+// Delete removes the mark with key, and reports whether there was one.
+func (m *Marks) Delete(key string) bool {
+	i := m.Index(key)
+	if i < 0 {
+		return false
+	}
+
+	*m = slices.Delete(*m, i, i+1)
+
+	return true
+}
+
+// Swap swaps the projects of two marks, so each key jumps to the project that
+// the other one did.
+func (m Marks) Swap(a, b string) error {
+	i, j := m.Index(a), m.Index(b)
+	if i < 0 {
+		return fmt.Errorf("no such mark %q", a)
+	}
+
+	if j < 0 {
+		return fmt.Errorf("no such mark %q", b)
+	}
+
+	m[i].Project, m[j].Project = m[j].Project, m[i].Project
+
+	return nil
+}
+
+// Move moves the mark with key to position in the list, counting from 0.
+func (m Marks) Move(key string, position int) error {
+	i := m.Index(key)
+	if i < 0 {
+		return fmt.Errorf("no such mark %q", key)
+	}
+
+	if position < 0 || position >= len(m) {
+		return fmt.Errorf("position %d is out of range, there are %d marks", position, len(m))
+	}
+
+	mark := m[i]
+
+	// Shift the marks in between towards where the mark was
+	if i < position {
+		copy(m[i:position], m[i+1:position+1])
+	} else {
+		copy(m[position+1:i+1], m[position:i])
+	}
+
+	m[position] = mark
+
+	return nil
+}
+
+// Step returns the mark that is delta places after the first mark for
+// project, wrapping around at the ends of the list.
+// If project isn't marked, stepping forwards starts from the first mark and
+// stepping backwards starts from the last one.
+func (m Marks) Step(project string, delta int) (Mark, bool) {
+	current := slices.IndexFunc(m, func(mark Mark) bool { return mark.Project == project })
+
+	i, ok := step(len(m), current, delta)
+	if !ok {
+		return Mark{}, false
+	}
+
+	return m[i], true
+}
+
+// step moves delta places from current in a list of n items, wrapping around
+// at the ends.
+// If current is negative, moving forwards starts from the first item and
+// moving backwards starts from the last one.
+func step(n, current, delta int) (int, bool) {
+	if n == 0 {
+		return 0, false
+	}
+
+	if current < 0 {
+		if delta > 0 {
+			current, delta = 0, delta-1
+		} else {
+			current, delta = n-1, delta+1
+		}
 	}
 
-	var m FileMarks
-	if err := json.Unmarshal(data, &m); err != nil {
+	return ((current+delta)%n + n) % n, true
+}
+
+type FileMarks map[string]FileMark
+
+func ReadFileMarks(path string) (FileMarks, error) {
+	m := FileMarks{}
+	if err := readFile(path, &m); err != nil {
 		return nil, err
 	}
 
+	// The marks are null if the file was edited by hand
+	if m == nil {
+		m = FileMarks{}
+	}
+
 	return m, nil
 }
 
-func (m FileMarks) Write(path string) error {
-	data, err := json.MarshalIndent(m, "", "  ")
+// Keys returns the keys of the file marks, sorted with numbers first in
+// numeric order.
+func (m FileMarks) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	slices.SortFunc(keys, compareKeys)
+
+	return keys
+}
+
+// Step returns the key of the file mark that is delta places after the mark
+// with key current, in the order of [FileMarks.Keys], wrapping around at the
+// ends.
+// If there is no mark with key current, stepping forwards starts from the
+// first mark and stepping backwards starts from the last one.
+func (m FileMarks) Step(current string, delta int) (string, bool) {
+	keys := m.Keys()
+
+	i, ok := step(len(keys), slices.Index(keys, current), delta)
+	if !ok {
+		return "", false
+	}
+
+	return keys[i], true
+}
+
+// UpdateFileMarks is like [UpdateMarks] for file marks.
+func UpdateFileMarks(path string, update func(m FileMarks) error) error {
+	unlock, err := lockFile(path)
 	if err != nil {
 		return err
 	}
 
-	data = append(data, '\n')
+	defer unlock()
 
-	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+	m, err := ReadFileMarks(path)
+	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0666)
+	if err := update(m); err != nil {
+		return err
+	}
+
+	return m.Write(path)
+}
+
+func (m FileMarks) Write(path string) error {
+	return writeFile(path, m)
 }
 
 type FileMark struct {
 	Path   string `json:"path"`
 	Line   uint64 `json:"line"`
 	Column uint64 `json:"col"`
+	// Anchor is the content of the file around the mark, which is used to
+	// find the mark again after lines are added or removed above it.
+	Anchor *Anchor `json:"anchor,omitempty"`
+	// Note describes the mark.
+	Note string   `json:"note,omitempty"`
+	Tags []string `json:"tags,omitempty"`
 }
 
 func File(path string, line, col uint64) FileMark {
-	return FileMark{path, line, col}
+	return FileMark{Path: path, Line: line, Column: col}
 }
 
 func (fm FileMark) String() string {
@@ -0,0 +1,205 @@
+package marks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMarks(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Data     string
+		Expected Marks
+	}{
+		{
+			Name:     "list",
+			Data:     `[{"key": "b", "project": "~/b"}, {"key": "a", "project": "~/a"}]`,
+			Expected: Marks{{"b", "~/b"}, {"a", "~/a"}},
+		},
+		{
+			Name:     "versioned",
+			Data:     `{"version": 1, "marks": [{"key": "version", "project": "~/v"}]}`,
+			Expected: Marks{{"version", "~/v"}},
+		},
+		{
+			Name:     "object with a version mark",
+			Data:     `{"version": "~/v"}`,
+			Expected: Marks{{"version", "~/v"}},
+		},
+		{
+			Name:     "object",
+			Data:     `{"foo": "~/foo", "10": "~/ten", "2": "~/two", "bar": "~/bar"}`,
+			Expected: Marks{{"2", "~/two"}, {"10", "~/ten"}, {"bar", "~/bar"}, {"foo", "~/foo"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "marks.json")
+			require.NoError(t, os.WriteFile(path, []byte(test.Data), 0666))
+
+			m, err := ReadMarks(path)
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, m)
+
+			// Marks are always written as a list in a versioned file
+			require.NoError(t, m.Write(path))
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Contains(t, string(data), `"version": 1`)
+
+			m, err = ReadMarks(path)
+			require.NoError(t, err)
+			require.Equal(t, test.Expected, m)
+		})
+	}
+}
+
+func TestReadMarksNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "marks.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 2, "marks": {}}`), 0666))
+
+	_, err := ReadMarks(path)
+	require.EqualError(t, err, path+" was written by a newer version of torpedo (format version 2, expected at most 1)")
+
+	_, err = ReadFileMarks(path)
+	require.Error(t, err)
+}
+
+func TestReadFileMarks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "marks.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"a": {"path": "main.go", "line": 3, "col": 1}}`), 0666))
+
+	m, err := ReadFileMarks(path)
+	require.NoError(t, err)
+	require.Equal(t, FileMarks{"a": File("main.go", 3, 1)}, m)
+
+	require.NoError(t, m.Write(path))
+
+	m, err = ReadFileMarks(path)
+	require.NoError(t, err)
+	require.Equal(t, FileMarks{"a": File("main.go", 3, 1)}, m)
+}
+
+func TestUpdateMarks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "torpedo", "marks.json")
+
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	// Without the lock, some of the marks would be lost
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := UpdateMarks(path, func(m *Marks) error {
+				m.Add(fmt.Sprintf("~/%d", i))
+				return nil
+			})
+			require.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	m, err := ReadMarks(path)
+	require.NoError(t, err)
+	require.Len(t, m, 20)
+
+	// Nothing is written if the update fails
+	err = UpdateMarks(path, func(m *Marks) error {
+		m.Delete("0")
+		return m.Swap("0", "1")
+	})
+	require.Error(t, err)
+
+	m, err = ReadMarks(path)
+	require.NoError(t, err)
+	require.Len(t, m, 20)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "only the marks file is left")
+
+	// The lock is kept out of the directory of the marks
+	lockPath, err := lockFilePath(path)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(runtimeDir, "torpedo", "locks"), filepath.Dir(lockPath))
+	require.FileExists(t, lockPath)
+
+	otherPath, err := lockFilePath(filepath.Join(path, "..", "other.json"))
+	require.NoError(t, err)
+	require.NotEqual(t, lockPath, otherPath)
+}
+
+func TestMarks(t *testing.T) {
+	m := Marks{{"0", "~/a"}, {"foo", "~/foo"}}
+
+	require.Equal(t, "1", m.Add("~/b"))
+	require.Equal(t, "1", m.Add("~/b"))
+	require.True(t, m.Delete("0"))
+	require.False(t, m.Delete("0"))
+	require.Equal(t, "0", m.Add("~/c"))
+	require.Equal(t, Marks{{"foo", "~/foo"}, {"1", "~/b"}, {"0", "~/c"}}, m)
+
+	m.Set("foo", "~/bar")
+	m.Set("baz", "~/baz")
+	require.Equal(t, Marks{{"foo", "~/bar"}, {"1", "~/b"}, {"0", "~/c"}, {"baz", "~/baz"}}, m)
+
+	require.NoError(t, m.Swap("0", "1"))
+	require.Equal(t, Marks{{"foo", "~/bar"}, {"1", "~/c"}, {"0", "~/b"}, {"baz", "~/baz"}}, m)
+	require.EqualError(t, m.Swap("0", "2"), `no such mark "2"`)
+
+	require.NoError(t, m.Move("baz", 0))
+	require.Equal(t, Marks{{"baz", "~/baz"}, {"foo", "~/bar"}, {"1", "~/c"}, {"0", "~/b"}}, m)
+	require.NoError(t, m.Move("foo", 3))
+	require.Equal(t, Marks{{"baz", "~/baz"}, {"1", "~/c"}, {"0", "~/b"}, {"foo", "~/bar"}}, m)
+	require.EqualError(t, m.Move("foo", 4), "position 4 is out of range, there are 4 marks")
+}
+
+func TestStep(t *testing.T) {
+	m := Marks{{"0", "~/a"}, {"1", "~/b"}, {"foo", "~/c"}}
+
+	tests := []struct {
+		Project  string
+		Delta    int
+		Expected string
+	}{
+		{"~/a", 1, "1"},
+		{"~/c", 1, "0"},
+		{"~/a", -1, "foo"},
+		{"~/b", -1, "0"},
+		{"~/b", 4, "foo"},
+		{"~/unmarked", 1, "0"},
+		{"~/unmarked", -1, "foo"},
+		{"~/unmarked", 2, "1"},
+	}
+
+	for _, test := range tests {
+		mark, ok := m.Step(test.Project, test.Delta)
+		require.True(t, ok)
+		require.Equal(t, test.Expected, mark.Key, "%s %d", test.Project, test.Delta)
+	}
+
+	_, ok := Marks{}.Step("~/a", 1)
+	require.False(t, ok)
+
+	fm := FileMarks{"b": File("b.go", 1, 1), "10": File("a.go", 1, 1), "2": File("a.go", 2, 1)}
+	require.Equal(t, []string{"2", "10", "b"}, fm.Keys())
+
+	key, ok := fm.Step("b", 1)
+	require.True(t, ok)
+	require.Equal(t, "2", key)
+
+	key, ok = fm.Step("", -1)
+	require.True(t, ok)
+	require.Equal(t, "b", key)
+}
@@ -6,16 +6,31 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
-func Pick(items []string) (string, error) {
+// Options change how the items are shown.
+type Options struct {
+	// Preview is a command that shows more about the item under the cursor,
+	// which it is given as its last argument.
+	// Only fzf and skim can show previews, so it isn't used with other
+	// pickers.
+	Preview []string
+}
+
+func Pick(items []string, opts Options) (string, error) {
 	path, ok := os.LookupEnv("TORPEDO_PICKER")
 	if !ok {
 		path = "fzf"
 	}
 
-	cmd := exec.Command(path)
+	args := []string{}
+	if len(opts.Preview) > 0 && canPreview(path) {
+		args = append(args, "--preview", previewCommand(opts.Preview))
+	}
+
+	cmd := exec.Command(path, args...)
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = bytes.NewBuffer([]byte(strings.Join(items, "\n")))
 
@@ -33,3 +48,24 @@ func Pick(items []string) (string, error) {
 
 	return "", errors.New("picker: command returned invalid item")
 }
+
+// canPreview reports whether the picker at path takes fzf's --preview flag.
+func canPreview(path string) bool {
+	switch filepath.Base(path) {
+	case "fzf", "fzf-tmux", "sk":
+		return true
+	}
+
+	return false
+}
+
+// previewCommand returns the shell command that fzf runs for the preview,
+// where fzf replaces {} with the quoted item.
+func previewCommand(command []string) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+
+	return strings.Join(quoted, " ") + " {}"
+}
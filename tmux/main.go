@@ -169,6 +169,8 @@ type NewWindow struct {
 	Environment    []string
 	Command        []string
 	Detached       bool
+	// PrintFormat prints information about the new window in this format.
+	PrintFormat string
 }
 
 func (opts *NewWindow) Args() []string {
@@ -181,6 +183,10 @@ func (opts *NewWindow) Args() []string {
 		args = append(args, "-d")
 	}
 
+	if opts.PrintFormat != "" {
+		args = append(args, "-P", "-F", opts.PrintFormat)
+	}
+
 	if opts.StartDirectory != "" {
 		args = append(args, "-c", opts.StartDirectory)
 	}
@@ -199,13 +205,50 @@ func (opts *NewWindow) Args() []string {
 }
 
 type SplitWindow struct {
+	TargetPane     string
 	StartDirectory string
 	Environment    []string
 	Command        []string
+	// Horizontal splits the pane into two panes side by side.
+	Horizontal bool
+	// Vertical splits the pane into two panes stacked on top of each other.
+	// This is the default if neither Horizontal or Vertical are set.
+	Vertical bool
+	// Size is the size of the new pane, either as a number of lines/columns
+	// or a percentage, e.g. "30%"
+	Size string
+	// Detached stops the new pane from becoming the active pane.
+	Detached bool
+	// PrintFormat prints information about the new pane in this format.
+	PrintFormat string
 }
 
 func (opts *SplitWindow) Args() []string {
 	args := []string{"split-window"}
+	if opts.Detached {
+		args = append(args, "-d")
+	}
+
+	if opts.PrintFormat != "" {
+		args = append(args, "-P", "-F", opts.PrintFormat)
+	}
+
+	if opts.Horizontal {
+		args = append(args, "-h")
+	}
+
+	if opts.Vertical {
+		args = append(args, "-v")
+	}
+
+	if opts.Size != "" {
+		args = append(args, "-l", opts.Size)
+	}
+
+	if opts.TargetPane != "" {
+		args = append(args, "-t", opts.TargetPane)
+	}
+
 	if opts.StartDirectory != "" {
 		args = append(args, "-c", opts.StartDirectory)
 	}
@@ -234,6 +277,7 @@ func (opts *SelectLayout) Args() []string {
 
 type SelectPane struct {
 	TargetPane string
+	Title      string
 }
 
 func (opts *SelectPane) Args() []string {
@@ -242,6 +286,28 @@ func (opts *SelectPane) Args() []string {
 		args = append(args, "-t", opts.TargetPane)
 	}
 
+	if opts.Title != "" {
+		args = append(args, "-T", opts.Title)
+	}
+
+	return args
+}
+
+type ResizePane struct {
+	TargetPane string
+	Zoom       bool
+}
+
+func (opts *ResizePane) Args() []string {
+	args := []string{"resize-pane"}
+	if opts.TargetPane != "" {
+		args = append(args, "-t", opts.TargetPane)
+	}
+
+	if opts.Zoom {
+		args = append(args, "-Z")
+	}
+
 	return args
 }
 
@@ -258,6 +324,47 @@ func (opts *SelectWindow) Args() []string {
 	return args
 }
 
+type KillWindow struct {
+	TargetWindow string
+}
+
+func (opts *KillWindow) Args() []string {
+	args := []string{"kill-window"}
+	if opts.TargetWindow != "" {
+		args = append(args, "-t", opts.TargetWindow)
+	}
+
+	return args
+}
+
+type RespawnPane struct {
+	TargetPane     string
+	StartDirectory string
+	Command        []string
+	// Kill kills the command in the pane if it is still running, otherwise
+	// only dead panes can be respawned.
+	Kill bool
+}
+
+func (opts *RespawnPane) Args() []string {
+	args := []string{"respawn-pane"}
+	if opts.Kill {
+		args = append(args, "-k")
+	}
+
+	if opts.StartDirectory != "" {
+		args = append(args, "-c", opts.StartDirectory)
+	}
+
+	if opts.TargetPane != "" {
+		args = append(args, "-t", opts.TargetPane)
+	}
+
+	args = append(args, opts.Command...)
+
+	return args
+}
+
 type ListWindows struct {
 	TargetSession string
 	Format        string
@@ -276,9 +383,24 @@ func (opts *ListWindows) Args() []string {
 	return args
 }
 
+type ListSessions struct {
+	Format string
+}
+
+func (opts *ListSessions) Args() []string {
+	args := []string{"list-sessions"}
+	if opts.Format != "" {
+		args = append(args, "-F", opts.Format)
+	}
+
+	return args
+}
+
 type SendKeys struct {
 	TargetPane string
-	Keys       []string
+	// Literal disables key name lookup, so each key is sent as literal text.
+	Literal bool
+	Keys    []string
 }
 
 func (opts *SendKeys) Args() []string {
@@ -288,12 +410,130 @@ func (opts *SendKeys) Args() []string {
 		args = append(args, "-t", opts.TargetPane)
 	}
 
+	if opts.Literal {
+		args = append(args, "-l")
+	}
+
 	args = append(args, opts.Keys...)
 
 	return args
 }
 
+type RunShell struct {
+	TargetPane string
+	Background bool
+	// Command is expanded as a format by tmux before it is passed to the shell.
+	Command string
+}
+
+func (opts *RunShell) Args() []string {
+	args := []string{"run-shell"}
+
+	if opts.Background {
+		args = append(args, "-b")
+	}
+
+	if opts.TargetPane != "" {
+		args = append(args, "-t", opts.TargetPane)
+	}
+
+	args = append(args, opts.Command)
+
+	return args
+}
+
+type DisplayPopup struct {
+	TargetPane     string
+	StartDirectory string
+	Title          string
+	// CloseOnExit closes the popup when the command exits, otherwise it
+	// stays open until a key is pressed.
+	CloseOnExit bool
+	Width       string
+	Height      string
+	// Command is passed to the shell.
+	Command string
+}
+
+func (opts *DisplayPopup) Args() []string {
+	args := []string{"display-popup"}
+	if opts.CloseOnExit {
+		args = append(args, "-E")
+	}
+
+	if opts.StartDirectory != "" {
+		args = append(args, "-d", opts.StartDirectory)
+	}
+
+	if opts.TargetPane != "" {
+		args = append(args, "-t", opts.TargetPane)
+	}
+
+	if opts.Title != "" {
+		args = append(args, "-T", opts.Title)
+	}
+
+	if opts.Width != "" {
+		args = append(args, "-w", opts.Width)
+	}
+
+	if opts.Height != "" {
+		args = append(args, "-h", opts.Height)
+	}
+
+	if opts.Command != "" {
+		args = append(args, opts.Command)
+	}
+
+	return args
+}
+
+type DisplayMessage struct {
+	TargetPane string
+	// Print writes the message to stdout, instead of showing it in the
+	// status line.
+	Print bool
+	// Hold shows the message until a key is pressed, instead of for the
+	// display-time option.
+	Hold    bool
+	Message string
+}
+
+func (opts *DisplayMessage) Args() []string {
+	args := []string{"display-message"}
+	if opts.Print {
+		args = append(args, "-p")
+	}
+
+	if opts.Hold {
+		args = append(args, "-d", "0")
+	}
+
+	if opts.TargetPane != "" {
+		args = append(args, "-t", opts.TargetPane)
+	}
+
+	return append(args, opts.Message)
+}
+
+type WaitFor struct {
+	Channel string
+	// Signal wakes up anything waiting on the channel, instead of waiting.
+	Signal bool
+}
+
+func (opts *WaitFor) Args() []string {
+	args := []string{"wait-for"}
+	if opts.Signal {
+		args = append(args, "-S")
+	}
+
+	return append(args, opts.Channel)
+}
+
 type ListPanes struct {
+	// All lists the panes of every session.
+	All     bool
 	Session bool
 	Target  string
 	Filter  string
@@ -303,6 +543,10 @@ type ListPanes struct {
 func (opts *ListPanes) Args() []string {
 	args := []string{"list-panes"}
 
+	if opts.All {
+		args = append(args, "-a")
+	}
+
 	if opts.Session {
 		args = append(args, "-s")
 	}
@@ -325,12 +569,18 @@ func (opts *ListPanes) Args() []string {
 type ShowOptions struct {
 	OnlyValue bool
 	Global    bool
-	Name      string
+	// Quiet prints nothing for an option that isn't set, instead of failing.
+	Quiet bool
+	Name  string
 }
 
 func (opts *ShowOptions) Args() []string {
 	args := []string{"show-options"}
 
+	if opts.Quiet {
+		args = append(args, "-q")
+	}
+
 	if opts.OnlyValue {
 		args = append(args, "-v")
 	}
@@ -346,6 +596,91 @@ func (opts *ShowOptions) Args() []string {
 	return args
 }
 
+type SetOption struct {
+	Target string
+	Global bool
+	// Pane sets a pane option, rather than a session option.
+	Pane bool
+	// Unset removes the option, and Value is ignored.
+	Unset bool
+	Name  string
+	Value string
+}
+
+func (opts *SetOption) Args() []string {
+	args := []string{"set-option"}
+
+	if opts.Global {
+		args = append(args, "-g")
+	}
+
+	if opts.Unset {
+		args = append(args, "-u")
+	}
+
+	if opts.Pane {
+		args = append(args, "-p")
+	}
+
+	if opts.Target != "" {
+		args = append(args, "-t", opts.Target)
+	}
+
+	if opts.Unset {
+		return append(args, opts.Name)
+	}
+
+	args = append(args, opts.Name, opts.Value)
+
+	return args
+}
+
+type SetEnvironment struct {
+	TargetSession string
+	Global        bool
+	Name          string
+	Value         string
+}
+
+func (opts *SetEnvironment) Args() []string {
+	args := []string{"set-environment"}
+
+	if opts.Global {
+		args = append(args, "-g")
+	}
+
+	if opts.TargetSession != "" {
+		args = append(args, "-t", opts.TargetSession)
+	}
+
+	args = append(args, opts.Name, opts.Value)
+
+	return args
+}
+
+type SetHook struct {
+	TargetSession string
+	Global        bool
+	Name          string
+	Command       string
+}
+
+func (opts *SetHook) Args() []string {
+	args := []string{"set-hook"}
+
+	if opts.Global {
+		args = append(args, "-g")
+	}
+
+	if opts.TargetSession != "" {
+		args = append(args, "-t", opts.TargetSession)
+	}
+
+	args = append(args, opts.Name, opts.Command)
+
+	return args
+}
+
 type StartServer struct{}
 
 func (opts *StartServer) Args() []string {
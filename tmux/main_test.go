@@ -36,6 +36,126 @@ func TestCommands(t *testing.T) {
 			Command:  &NewSession{Environment: []string{"FOO=1", "BAR=2"}},
 			Expected: []string{"new-session", "-e", "FOO=1", "-e", "BAR=2"},
 		},
+		// split-window
+		{
+			Command:  &SplitWindow{},
+			Expected: []string{"split-window"},
+		},
+		{
+			Command:  &SplitWindow{Horizontal: true, Size: "30%"},
+			Expected: []string{"split-window", "-h", "-l", "30%"},
+		},
+		{
+			Command:  &SplitWindow{Vertical: true, TargetPane: "1", StartDirectory: "foo"},
+			Expected: []string{"split-window", "-v", "-t", "1", "-c", "foo"},
+		},
+		{
+			Command:  &SplitWindow{Environment: []string{"FOO=1"}, Command: []string{"man", "tmux"}},
+			Expected: []string{"split-window", "-e", "FOO=1", "man", "tmux"},
+		},
+		{
+			Command:  &SplitWindow{TargetPane: "=proj:", Detached: true, Command: []string{"make"}},
+			Expected: []string{"split-window", "-d", "-t", "=proj:", "make"},
+		},
+		{
+			Command:  &SplitWindow{Detached: true, PrintFormat: "#{pane_id}", Command: []string{"make"}},
+			Expected: []string{"split-window", "-d", "-P", "-F", "#{pane_id}", "make"},
+		},
+		// resize-pane
+		{
+			Command:  &ResizePane{TargetPane: "2", Zoom: true},
+			Expected: []string{"resize-pane", "-t", "2", "-Z"},
+		},
+		// select-pane
+		{
+			Command:  &SelectPane{TargetPane: "1", Title: "logs"},
+			Expected: []string{"select-pane", "-t", "1", "-T", "logs"},
+		},
+		// kill-window
+		{
+			Command:  &KillWindow{TargetWindow: "@3"},
+			Expected: []string{"kill-window", "-t", "@3"},
+		},
+		// respawn-pane
+		{
+			Command:  &RespawnPane{TargetPane: "=proj:=test.", Kill: true, StartDirectory: "/proj", Command: []string{"go", "test"}},
+			Expected: []string{"respawn-pane", "-k", "-c", "/proj", "-t", "=proj:=test.", "go", "test"},
+		},
+		// display-popup
+		{
+			Command:  &DisplayPopup{TargetPane: "=proj:", StartDirectory: "/proj", Title: "test", Width: "80%", Height: "80%", Command: "go test"},
+			Expected: []string{"display-popup", "-d", "/proj", "-t", "=proj:", "-T", "test", "-w", "80%", "-h", "80%", "go test"},
+		},
+		// list-sessions
+		{
+			Command:  &ListSessions{},
+			Expected: []string{"list-sessions"},
+		},
+		{
+			Command:  &ListSessions{Format: "#{session_name}"},
+			Expected: []string{"list-sessions", "-F", "#{session_name}"},
+		},
+		// display-message
+		{
+			Command:  &DisplayMessage{TargetPane: "%1", Print: true, Message: "#{session_name}"},
+			Expected: []string{"display-message", "-p", "-t", "%1", "#{session_name}"},
+		},
+		{
+			Command:  &DisplayMessage{TargetPane: "%1", Hold: true, Message: "failed"},
+			Expected: []string{"display-message", "-d", "0", "-t", "%1", "failed"},
+		},
+		// wait-for
+		{
+			Command:  &WaitFor{Channel: "done"},
+			Expected: []string{"wait-for", "done"},
+		},
+		{
+			Command:  &WaitFor{Channel: "done", Signal: true},
+			Expected: []string{"wait-for", "-S", "done"},
+		},
+		// send-keys
+		{
+			Command:  &SendKeys{TargetPane: "1", Literal: true, Keys: []string{"psql"}},
+			Expected: []string{"send-keys", "-t", "1", "-l", "psql"},
+		},
+		// run-shell
+		{
+			Command:  &RunShell{TargetPane: "1", Background: true, Command: "echo #{pane_id}"},
+			Expected: []string{"run-shell", "-b", "-t", "1", "echo #{pane_id}"},
+		},
+		// set-option
+		{
+			Command:  &SetOption{Target: "foo", Name: "status-style", Value: "bg=red"},
+			Expected: []string{"set-option", "-t", "foo", "status-style", "bg=red"},
+		},
+		{
+			Command:  &SetOption{Target: "%1", Pane: true, Name: "remain-on-exit", Value: "on"},
+			Expected: []string{"set-option", "-p", "-t", "%1", "remain-on-exit", "on"},
+		},
+		{
+			Command:  &SetOption{Global: true, Unset: true, Name: "@done"},
+			Expected: []string{"set-option", "-g", "-u", "@done"},
+		},
+		// show-options
+		{
+			Command:  &ShowOptions{Global: true, Quiet: true, OnlyValue: true, Name: "@done"},
+			Expected: []string{"show-options", "-q", "-v", "-g", "@done"},
+		},
+		// list-panes
+		{
+			Command:  &ListPanes{All: true, Filter: "#{==:#{pane_id},%1}", Format: "#{pane_dead}"},
+			Expected: []string{"list-panes", "-a", "-F", "#{pane_dead}", "-f", "#{==:#{pane_id},%1}"},
+		},
+		// set-environment
+		{
+			Command:  &SetEnvironment{TargetSession: "foo", Name: "FOO", Value: "1"},
+			Expected: []string{"set-environment", "-t", "foo", "FOO", "1"},
+		},
+		// set-hook
+		{
+			Command:  &SetHook{Global: true, Name: "pane-exited", Command: "display-message bye"},
+			Expected: []string{"set-hook", "-g", "pane-exited", "display-message bye"},
+		},
 	}
 
 	for _, test := range tests {